@@ -0,0 +1,239 @@
+package urfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SampleArchive samples the files contained in a source directory (src) with
+// some probability between 0 and 1 (size) as Sample does, but rather than
+// copying the files to a directory, writes them into a gzip compressed tar
+// archive (dstArchive) using the relative paths as the entry names. The
+// archive is written to a temporary file and only moved to dstArchive once
+// the sample is complete. On a dry run, no archive is written.
+func (fs *FSWalker) SampleArchive(src, dstArchive string, size float64) (string, error) {
+	// Create the temporary archive file and the tar and gzip writers
+	var (
+		err error
+		tmp *os.File
+		gz  *gzip.Writer
+		tw  *tar.Writer
+	)
+
+	if !fs.DryRun {
+		if tmp, err = ioutil.TempFile(filepath.Dir(dstArchive), ""); err != nil {
+			return "", err
+		}
+
+		gz = gzip.NewWriter(tmp)
+		tw = tar.NewWriter(gz)
+	}
+
+	// Cleanup the temporary file on error
+	abort := func(err error) (string, error) {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		return "", err
+	}
+
+	// The tar writer is not safe for concurrent use
+	var mu sync.Mutex
+	salt := fs.salt()
+	archived := make([]string, 0)
+
+	// Run the walk with our archiving function
+	err = fs.Walk(src, func(path string) (string, error) {
+		// Get the relative path from the base
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
+
+		// If we're not in the sample percent, do no work
+		if sampleKey(salt, rel) > size {
+			return "", nil
+		}
+
+		name := filepath.ToSlash(rel)
+		if !fs.DryRun {
+			mu.Lock()
+			err = writeTarEntry(tw, name, path)
+			mu.Unlock()
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		mu.Lock()
+		archived = append(archived, name)
+		mu.Unlock()
+		return name, nil
+	})
+
+	// If an error occured return it
+	if err != nil {
+		return abort(err)
+	}
+
+	// Flush the writers and move the archive into place, giving it the same
+	// permissions as the files copied by a sample rather than the 0600 of
+	// the temporary file.
+	if !fs.DryRun {
+		if err = tw.Close(); err != nil {
+			return abort(err)
+		}
+
+		if err = gz.Close(); err != nil {
+			return abort(err)
+		}
+
+		if err = tmp.Chmod(0644); err != nil {
+			return abort(err)
+		}
+
+		if err = tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+
+		if err = os.Rename(tmp.Name(), dstArchive); err != nil {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+	}
+
+	// Return a statement of how much was archived
+	result := fs.newSampleResult(archived, fs.duration)
+	return result.String() + " into " + dstArchive, nil
+}
+
+// Internal helper function that writes the file at path to the tar writer as
+// an entry with the specified name. Must not be called concurrently.
+func writeTarEntry(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Internal helper function that returns true if the name has the extension
+// of an archive that can be read: .zip, .tar, .tar.gz or .tgz.
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Internal helper function that reads the archive at path on the walker's
+// file system, returning the uncompressed size of each of the regular files
+// it contains. A corrupt archive returns an error.
+func (fs *FSWalker) archiveSizes(path string) ([]int64, error) {
+	f, err := fs.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return zipSizes(path, f)
+	}
+
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(path), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive %s: %s", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	sizes := make([]int64, 0)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return sizes, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive %s: %s", path, err)
+		}
+
+		if hdr.FileInfo().Mode().IsRegular() {
+			sizes = append(sizes, hdr.Size)
+		}
+	}
+}
+
+// Internal helper function that returns the uncompressed size of each of the
+// files in the zip archive at path, reading the archive into memory if it is
+// not a file on the real file system that can be read at random.
+func zipSizes(path string, f io.Reader) ([]int64, error) {
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+
+	if file, ok := f.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		ra, size = file, info.Size()
+	} else {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("could not read archive %s: %s", path, err)
+	}
+
+	sizes := make([]int64, 0, len(zr.File))
+	for _, file := range zr.File {
+		if file.Mode().IsRegular() {
+			sizes = append(sizes, int64(file.UncompressedSize64))
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,180 @@
+package urfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleArchive(t *testing.T) {
+	src := makeSampleTree(t, 30)
+	defer os.RemoveAll(src)
+
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+
+	fs := makeWalker()
+	archive := filepath.Join(tmpdir, "sample.tar.gz")
+	if _, err := fs.SampleArchive(src, archive, 0.5); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// read the archive and compare each entry to the source file
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var entries uint64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		expected, err := ioutil.ReadFile(filepath.Join(src, filepath.FromSlash(hdr.Name)))
+		if err != nil {
+			t.Errorf("archive entry %s not in source: %s", hdr.Name, err)
+			continue
+		}
+
+		if string(data) != string(expected) {
+			t.Errorf("archive entry %s does not match source", hdr.Name)
+		}
+		entries++
+	}
+
+	if entries != fs.NumResults() {
+		t.Errorf("expected %d entries in the archive, got %d", fs.NumResults(), entries)
+	}
+
+	// the archive is readable by others rather than keeping the temp file mode
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected archive mode 0644, got %s", info.Mode().Perm())
+	}
+
+	// a dry run does not write anything into the destination directory
+	fs = makeWalker()
+	fs.DryRun = true
+	dryrun := filepath.Join(tmpdir, "dryrun")
+	if err := os.Mkdir(dryrun, 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := fs.SampleArchive(src, filepath.Join(dryrun, "sample.tar.gz"), 0.5); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if names, _ := ioutil.ReadDir(dryrun); len(names) != 0 {
+		t.Errorf("expected no files written on a dry run, found %d", len(names))
+	}
+
+	if fs.NumResults() == 0 {
+		t.Error("expected a dry run to still select files for the archive")
+	}
+}
+
+func TestCountIntoArchives(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"plain.txt": "12345",
+	})
+	defer os.RemoveAll(root)
+
+	// A zip archive with two files and a directory
+	zf, err := os.Create(filepath.Join(root, "data.zip"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	zw := zip.NewWriter(zf)
+	for name, data := range map[string]string{"a.txt": "aaaa", "sub/b.txt": "bbbbbbbb"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		io.WriteString(w, data)
+	}
+
+	if _, err := zw.Create("sub/"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	zf.Close()
+
+	// A gzip compressed tar archive with one file
+	tf, err := os.Create(filepath.Join(root, "data.tar.gz"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	gz := gzip.NewWriter(tf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "c.txt", Mode: 0644, Size: 3, Typeflag: tar.TypeReg})
+	io.WriteString(tw, "ccc")
+	tw.Close()
+	gz.Close()
+	tf.Close()
+
+	fs := makeWalker()
+	fs.IntoArchives = true
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 4 || sizes[0].Bytes != 20 {
+		t.Errorf("expected 4 files and 20 bytes, got %d files and %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	// A corrupt archive is an error unless continuing on error
+	if err := ioutil.WriteFile(filepath.Join(root, "bad.zip"), []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err = fs.Count(false, root); err == nil {
+		t.Error("expected an error counting a corrupt archive")
+	}
+
+	fs.ContinueOnError = true
+	size := &DirSize{Path: root}
+	if err = fs.Walk(root, fs.sizeFunc(size)); err == nil {
+		t.Fatal("expected the corrupt archive to be collected as an error")
+	} else if _, ok := err.(WalkErrors); !ok {
+		t.Fatalf("expected walk errors, got %v", err)
+	}
+
+	if size.Files != 4 || size.Bytes != 20 {
+		t.Errorf("expected 4 files and 20 bytes, got %d files and %d bytes", size.Files, size.Bytes)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux || openbsd || dragonfly || solaris
+// +build linux openbsd dragonfly solaris
+
+package urfs
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Internal helper that returns the access time of the file, falling back to
+// the modification time if the access time is not available.
+func atime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd && !windows
+// +build !linux,!openbsd,!dragonfly,!solaris,!darwin,!freebsd,!netbsd,!windows
+
+package urfs
+
+import (
+	"os"
+	"time"
+)
+
+// Internal helper that returns the access time of the file, which is not
+// available on this platform so the modification time is used instead.
+func atime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
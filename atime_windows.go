@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package urfs
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Internal helper that returns the access time of the file, falling back to
+// the modification time if the access time is not available.
+func atime(info os.FileInfo) time.Time {
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(0, attr.LastAccessTime.Nanoseconds())
+}
@@ -0,0 +1,195 @@
+package urfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WriteChecksums walks the root directory, computing the SHA-256 digest of
+// every file with the workers, and writes a manifest of "<digest>  <path>"
+// lines sorted by the path of each file relative to root, in the same format
+// as sha256sum. If the manifest is inside of root it is not included.
+func (fs *FSWalker) WriteChecksums(root, manifest string) error {
+	exclude, err := filepath.Abs(manifest)
+	if err != nil {
+		return err
+	}
+
+	digests, err := fs.relDigests(root, exclude)
+	if err != nil {
+		return err
+	}
+
+	// Write the digests in a deterministic order from a single goroutine
+	paths := make([]string, 0, len(digests))
+	for rel := range digests {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	f, err := os.Create(manifest)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, rel := range paths {
+		fmt.Fprintf(w, "%s  %s\n", digests[rel], rel)
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// VerifyChecksums reads a manifest written by WriteChecksums and recomputes
+// the digest of each of the files it lists relative to the root directory
+// with the workers. Returns the sorted relative paths of the files whose
+// contents no longer match the manifest, including files that are missing.
+// Files in root that are not listed in the manifest are not checked.
+func (fs *FSWalker) VerifyChecksums(root, manifest string) ([]string, error) {
+	expected, err := readChecksums(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(expected))
+	for rel := range expected {
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(rel)))
+	}
+
+	var mu sync.Mutex
+	mismatched := make([]string, 0)
+
+	err = fs.run(fs.list(paths), func(path string) (string, error) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return "", err
+		}
+		rel = filepath.ToSlash(rel)
+
+		digest, err := hashFile(path, sha256.New())
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if digest != expected[rel] {
+			mu.Lock()
+			mismatched = append(mismatched, rel)
+			mu.Unlock()
+		}
+		return path, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(mismatched)
+	return mismatched, nil
+}
+
+// Internal helper function that reads the manifest of checksums into a map
+// of relative path to digest, accepting both the text and binary mode lines
+// written by sha256sum.
+func readChecksums(manifest string) (map[string]string, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || len(parts[1]) < 2 || (parts[1][0] != ' ' && parts[1][0] != '*') {
+			return nil, fmt.Errorf("could not parse line %d of checksum manifest %s", n, manifest)
+		}
+		checksums[parts[1][1:]] = parts[0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
+
+// TreeHash computes a single SHA-256 digest of the contents of the tree at
+// root for integrity checks: every file is hashed by the workers, then the
+// "<path>:<digest>" lines of the files, with the slash separated path of
+// each relative to root, are sorted by path and hashed together. The digest
+// is reproducible regardless of where the tree is located or the order the
+// files are processed in, and changes if any file is added, removed,
+// renamed, or modified. Only the files selected by the filters of the walker
+// are included, e.g. hidden files are skipped by default, and file modes and
+// times are not part of the digest.
+func (fs *FSWalker) TreeHash(root string) (string, error) {
+	digests, err := fs.relDigests(root, "")
+	if err != nil {
+		return "", err
+	}
+
+	paths := make([]string, 0, len(digests))
+	for rel := range digests {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, rel := range paths {
+		fmt.Fprintf(h, "%s:%s\n", rel, digests[rel])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Internal helper function that walks the root directory, computing the
+// SHA-256 digest of every file with the workers, and returns the digests by
+// the slash separated path of each file relative to root. The file at the
+// absolute path exclude, if any, is skipped.
+func (fs *FSWalker) relDigests(root, exclude string) (map[string]string, error) {
+	var mu sync.Mutex
+	digests := make(map[string]string)
+
+	err := fs.Walk(root, func(path string) (string, error) {
+		if exclude != "" {
+			if abs, err := filepath.Abs(path); err == nil && abs == exclude {
+				return "", nil
+			}
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return "", err
+		}
+
+		digest, err := hashFile(path, sha256.New())
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		digests[filepath.ToSlash(rel)] = digest
+		mu.Unlock()
+		return path, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
@@ -0,0 +1,147 @@
+package urfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b.txt":     "world",
+		"sub/c.txt": "foo",
+		"sub/d.txt": "bar",
+	})
+	defer os.RemoveAll(root)
+
+	// the manifest is written inside of root but is not included in itself
+	manifest := filepath.Join(root, "MANIFEST.sha256")
+	fs := makeWalker()
+	if err := fs.WriteChecksums(root, manifest); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []string{
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  a.txt",
+		"486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7  b.txt",
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  sub/c.txt",
+		"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  sub/d.txt",
+	}
+
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected manifest:\n%s", data)
+	}
+
+	// an unmodified tree should verify
+	fs = makeWalker()
+	mismatched, err := fs.VerifyChecksums(root, manifest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(mismatched) != 0 {
+		t.Fatalf("expected tree to verify, got %v", mismatched)
+	}
+
+	// corrupt one file and remove another
+	if err := ioutil.WriteFile(filepath.Join(root, "sub", "c.txt"), []byte("fou"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := os.Remove(filepath.Join(root, "b.txt")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs = makeWalker()
+	mismatched, err = fs.VerifyChecksums(root, manifest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Join(mismatched, ",") != "b.txt,sub/c.txt" {
+		t.Errorf("expected corrupted and missing files to mismatch, got %v", mismatched)
+	}
+
+	// a malformed manifest returns an error
+	if err := ioutil.WriteFile(manifest, []byte("not a checksum line\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := makeWalker().VerifyChecksums(root, manifest); err == nil {
+		t.Error("expected error parsing a malformed manifest")
+	}
+}
+
+func TestTreeHash(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "hello world",
+		"sub/b.txt":     "hello there",
+		"sub/deep/c.go": "package c",
+	}
+
+	// Identical trees in different directories have the same digest
+	one := makeTree(t, files)
+	defer os.RemoveAll(one)
+
+	two := makeTree(t, files)
+	defer os.RemoveAll(two)
+
+	fs := makeWalker()
+	expected, err := fs.TreeHash(one)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(expected) != 64 {
+		t.Fatalf("expected a hex SHA-256 digest, got %q", expected)
+	}
+
+	if digest, err := fs.TreeHash(two); err != nil {
+		t.Fatal(err.Error())
+	} else if digest != expected {
+		t.Errorf("expected identical trees to have the same digest, got %s and %s", expected, digest)
+	}
+
+	// A change anywhere in the tree changes the digest
+	changes := []func(root string) error{
+		func(root string) error {
+			return ioutil.WriteFile(filepath.Join(root, "sub", "deep", "c.go"), []byte("package d"), 0644)
+		},
+		func(root string) error {
+			return os.Rename(filepath.Join(root, "a.txt"), filepath.Join(root, "z.txt"))
+		},
+		func(root string) error {
+			return os.Remove(filepath.Join(root, "sub", "b.txt"))
+		},
+		func(root string) error {
+			return ioutil.WriteFile(filepath.Join(root, "sub", "new.txt"), nil, 0644)
+		},
+	}
+
+	for i, change := range changes {
+		root := makeTree(t, files)
+		defer os.RemoveAll(root)
+
+		if err := change(root); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		digest, err := fs.TreeHash(root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if digest == expected {
+			t.Errorf("change %d: expected the digest of the tree to change", i)
+		}
+	}
+}
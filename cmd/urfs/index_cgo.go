@@ -0,0 +1,16 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Internal helper that opens the SQLite database of the index with the
+// SQLite driver, which is written in C and so requires cgo.
+func openIndex(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", path)
+}
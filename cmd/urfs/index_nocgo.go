@@ -0,0 +1,15 @@
+//go:build !cgo
+// +build !cgo
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Internal helper that reports that the index is unavailable, since the
+// SQLite driver requires cgo and this binary was built without it.
+func openIndex(path string) (*sql.DB, error) {
+	return nil, errors.New("the index command requires cgo, rebuild urfs with CGO_ENABLED=1 and a C compiler")
+}
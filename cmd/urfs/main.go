@@ -2,17 +2,40 @@
 package main
 
 import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/bbengfort/urfs"
+	"github.com/fsnotify/fsnotify"
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli"
 	"golang.org/x/net/context"
 )
 
-var fs *urfs.FSWalker
+var (
+	fs      *urfs.FSWalker
+	cancel  context.CancelFunc
+	logger  *log.Logger
+	logFile *os.File
+	stdout  io.Writer = os.Stdout
+	stderr  io.Writer = os.Stderr
+	stdin   io.Reader = os.Stdin
+)
 
 //===========================================================================
 // Main Method
@@ -23,12 +46,20 @@ func main() {
 	// Load the .env file if it exists
 	godotenv.Load()
 
+	// Run the application
+	newApp().Run(os.Args)
+}
+
+// Creates the command line application, whose commands write their output
+// to stdout so that tests can capture it.
+func newApp() *cli.App {
 	// Instantiate the command line application
 	app := cli.NewApp()
 	app.Name = "urfs"
 	app.Version = "0.3"
 	app.Usage = "perform computations on files in a large directory"
 	app.Before = initWalker
+	app.After = closeWalker
 
 	// Define the global flags for the application
 	app.Flags = []cli.Flag{
@@ -37,11 +68,30 @@ func main() {
 			Value: "",
 			Usage: "specify a parsable duration to limit sampling",
 		},
+		cli.StringFlag{
+			Name:  "file-timeout",
+			Value: "",
+			Usage: "skip files that take longer than this duration to process, e.g. 30s",
+		},
 		cli.IntFlag{
 			Name:  "w, workers",
 			Value: urfs.DefaultWorkers,
 			Usage: "specify size of workers pool for system threads",
 		},
+		cli.IntFlag{
+			Name:  "buffer",
+			Value: urfs.DefaultBuffer,
+			Usage: "size of the channels of paths and results",
+		},
+		cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "log diagnostics such as skipped paths and retried copies to stderr",
+		},
+		cli.IntFlag{
+			Name:  "dir-workers",
+			Value: 1,
+			Usage: "number of directories to read concurrently, e.g. on deep trees or network mounts",
+		},
 		cli.BoolFlag{
 			Name:  "D, no-skip-dirs",
 			Usage: "do not skip directories",
@@ -51,9 +101,100 @@ func main() {
 			Usage: "do not skip hidden files and directories",
 		},
 		cli.StringFlag{
+			Name:  "include-hidden",
+			Value: "",
+			Usage: "comma separated patterns of hidden files to include, e.g. .gitignore",
+		},
+		cli.StringSliceFlag{
+			Name:  "skip-dir",
+			Usage: "skip directories with this name anywhere in the walk, e.g. node_modules (repeatable)",
+		},
+		cli.StringSliceFlag{
+			Name:  "hidden-prefix",
+			Usage: "treat names with this prefix as hidden, replacing the default . and ~ (repeatable)",
+		},
+		cli.StringSliceFlag{
 			Name:  "m, match",
-			Value: "*",
-			Usage: "specify a pattern to match files on",
+			Usage: "specify a pattern to match files on, matching any if repeated (default all files)",
+		},
+		cli.StringFlag{
+			Name:  "x, exclude",
+			Value: "",
+			Usage: "specify comma separated patterns to exclude files on",
+		},
+		cli.BoolFlag{
+			Name:  "match-path",
+			Usage: "match the pattern against the path relative to the root",
+		},
+		cli.BoolFlag{
+			Name:  "i, ignore-case",
+			Usage: "match and exclude patterns regardless of case",
+		},
+		cli.StringFlag{
+			Name:  "mime",
+			Value: "",
+			Usage: "only process files whose detected MIME type is in a comma separated list, e.g. image/jpeg,image/png",
+		},
+		cli.IntFlag{
+			Name:  "max-depth",
+			Value: 0,
+			Usage: "limit how deep the walk descends, 1 for only files in the root",
+		},
+		cli.StringFlag{
+			Name:  "min-size",
+			Value: "",
+			Usage: "skip files smaller than the size, e.g. 1K",
+		},
+		cli.StringFlag{
+			Name:  "max-size",
+			Value: "",
+			Usage: "skip files larger than the size, e.g. 1G",
+		},
+		cli.StringFlag{
+			Name:  "modified-after",
+			Value: "",
+			Usage: "skip files modified before the RFC3339 time or relative age, e.g. 7d",
+		},
+		cli.StringFlag{
+			Name:  "modified-before",
+			Value: "",
+			Usage: "skip files modified at or after the RFC3339 time or relative age, e.g. 7d",
+		},
+		cli.BoolFlag{
+			Name:  "L, follow-symlinks",
+			Usage: "follow symbolic links to files and directories",
+		},
+		cli.StringFlag{
+			Name:  "rate-limit",
+			Value: "",
+			Usage: "limit the bytes per second copied by all workers, e.g. 10M",
+		},
+		cli.StringFlag{
+			Name:  "log",
+			Value: "",
+			Usage: "append the results and errors of sample and count to a log file",
+		},
+		cli.BoolFlag{
+			Name:  "skip-denied",
+			Usage: "skip files and directories that cannot be read due to permissions",
+		},
+		cli.BoolFlag{
+			Name:  "profile",
+			Usage: "print how well the workers kept up with the walk and a tuning suggestion",
+		},
+		cli.BoolFlag{
+			Name:  "sorted",
+			Usage: "process files in sorted order for deterministic output, walking before processing",
+		},
+		cli.StringFlag{
+			Name:  "paths-from",
+			Value: "",
+			Usage: "read newline separated root paths from a file",
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Value: 0,
+			Usage: "specify a random seed for reproducible sampling",
 		},
 	}
 
@@ -62,26 +203,391 @@ func main() {
 		cli.Command{
 			Name:      "sample",
 			Usage:     "uniform random sample of files in a directory",
+			ArgsUsage: "src [src ...] dst",
+			Action:    logged(sample),
+			Flags: []cli.Flag{
+				cli.Float64Flag{
+					Name:  "s, sample",
+					Value: 0.1,
+					Usage: "approximate fractional size of sample",
+				},
+				cli.IntFlag{
+					Name:  "c, count",
+					Value: 0,
+					Usage: "exact number of files to sample, overrides --sample",
+				},
+				cli.BoolFlag{
+					Name:  "p, progress",
+					Usage: "print the progress of the sample to stderr",
+				},
+				cli.BoolFlag{
+					Name:  "P, preserve",
+					Usage: "preserve file mode and modification times",
+				},
+				cli.BoolFlag{
+					Name:  "n, dry-run",
+					Usage: "select the sample without copying any files",
+				},
+				cli.BoolFlag{
+					Name:  "require-files",
+					Usage: "exit with an error if no files are found or sampled",
+				},
+				cli.BoolFlag{
+					Name:  "f, flatten",
+					Usage: "copy files directly into dst without the directory structure",
+				},
+				cli.StringFlag{
+					Name:  "max-bytes",
+					Usage: "stop sampling before the copied files exceed the size, e.g. 500M",
+				},
+				cli.StringFlag{
+					Name:  "rename",
+					Usage: "name copied files with a template of .Index, .Base, .Ext and .Hash, e.g. 'img_{{printf \"%04d\" .Index}}{{.Ext}}'",
+				},
+				cli.BoolFlag{
+					Name:  "preserve-path",
+					Usage: "copy files to their full source path under dst, e.g. dst/var/log/app.log",
+				},
+				cli.BoolFlag{
+					Name:  "stratified",
+					Usage: "sample the fraction of files in each subdirectory of src independently",
+				},
+				cli.BoolFlag{
+					Name:  "weighted",
+					Usage: "select --count files with probability proportional to their size",
+				},
+				cli.IntFlag{
+					Name:  "copy-retries",
+					Value: 0,
+					Usage: "retry copies that fail with transient IO errors with exponential backoff",
+				},
+				cli.BoolFlag{
+					Name:  "no-overwrite",
+					Usage: "skip sampled files that already exist in dst rather than overwriting them",
+				},
+				cli.BoolFlag{
+					Name:  "unique",
+					Usage: "skip sampled files whose contents are identical to a file already copied",
+				},
+				cli.BoolFlag{
+					Name:  "sync",
+					Usage: "skip files that are unchanged in dst, preserving times for later syncs",
+				},
+				cli.BoolFlag{
+					Name:  "z, gzip",
+					Usage: "compress each copied file with gzip, adding a .gz extension",
+				},
+				cli.StringFlag{
+					Name:  "ext",
+					Usage: "only process files with these comma separated extensions, e.g. mp4,mkv",
+				},
+				cli.StringFlag{
+					Name:  "exclude-ext",
+					Usage: "skip files with these comma separated extensions, e.g. log,tmp",
+				},
+				cli.StringFlag{
+					Name:  "manifest",
+					Usage: "write a CSV of the source, destination and bytes of copied files",
+				},
+				cli.StringFlag{
+					Name:  "state",
+					Usage: "record copied files in a state file and skip them when resuming a sample",
+				},
+				cli.StringFlag{
+					Name:  "a, archive",
+					Value: "",
+					Usage: "write the sample to a .tar.gz archive rather than a directory",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "move",
+			Usage:     "move a uniform random sample of files to another directory",
 			ArgsUsage: "src dst",
-			Action:    sample,
+			Action:    move,
 			Flags: []cli.Flag{
 				cli.Float64Flag{
 					Name:  "s, sample",
 					Value: 0.1,
 					Usage: "approximate fractional size of sample",
 				},
+				cli.BoolFlag{
+					Name:  "prune-empty",
+					Usage: "remove directories in src left empty by the move",
+				},
+				cli.BoolFlag{
+					Name:  "y, yes",
+					Usage: "move the files without asking for confirmation",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "prune",
+			Usage:     "remove empty directories, including nested empty trees",
+			ArgsUsage: "dir [dir ...]",
+			Action:    prune,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "n, dry-run",
+					Usage: "print the directories that would be removed without removing them",
+				},
+				cli.BoolFlag{
+					Name:  "y, yes",
+					Usage: "remove the directories without asking for confirmation",
+				},
 			},
 		},
+		cli.Command{
+			Name:      "verify",
+			Usage:     "check that the files in dst are identical to those in src",
+			ArgsUsage: "src dst",
+			Action:    verify,
+		},
 		cli.Command{
 			Name:      "count",
 			Usage:     "compute number of files and bytes per directory",
 			ArgsUsage: "dir [dir ...]",
-			Action:    count,
+			Action:    logged(count),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "b, bytes",
+					Usage: "print raw byte counts without human readable sizes",
+				},
+				cli.BoolFlag{
+					Name:  "j, json",
+					Usage: "print the counts as a JSON array",
+				},
+				cli.BoolFlag{
+					Name:  "p, progress",
+					Usage: "print the progress of the count to stderr",
+				},
+				cli.StringFlag{
+					Name:  "files-from",
+					Usage: "count the files listed in a file (- for stdin) without walking",
+				},
+				cli.StringFlag{
+					Name:  "sort",
+					Usage: "sort the counts by bytes, files, or name (default input order)",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "print each count with a template, e.g. '{{.Path}} {{.Files}} {{.Bytes}} {{.Mean}}'",
+				},
+				cli.BoolFlag{
+					Name:  "reverse",
+					Usage: "reverse the order the counts are printed in",
+				},
+				cli.BoolFlag{
+					Name:  "q, quiet",
+					Usage: "do not print the count of each directory, e.g. only the total",
+				},
+				cli.BoolFlag{
+					Name:  "P, parallel",
+					Usage: "walk all of the directories concurrently",
+				},
+				cli.BoolFlag{
+					Name:  "t, total",
+					Usage: "print the total across all directories",
+				},
+				cli.BoolFlag{
+					Name:  "require-files",
+					Usage: "exit with an error if no files are counted",
+				},
+				cli.StringFlag{
+					Name:  "ext",
+					Usage: "only process files with these comma separated extensions, e.g. mp4,mkv",
+				},
+				cli.StringFlag{
+					Name:  "exclude-ext",
+					Usage: "skip files with these comma separated extensions, e.g. log,tmp",
+				},
+				cli.BoolFlag{
+					Name:  "dedup-links",
+					Usage: "count files that are hard linked together only once",
+				},
+				cli.BoolFlag{
+					Name:  "du, disk-usage",
+					Usage: "count the bytes allocated on disk rather than the apparent size of files",
+				},
+				cli.BoolFlag{
+					Name:  "into-archives",
+					Usage: "count the files and uncompressed bytes inside of .zip and .tar(.gz) archives",
+				},
+				cli.BoolFlag{
+					Name:  "no-empty",
+					Usage: "do not count zero-byte files",
+				},
+				cli.BoolFlag{
+					Name:  "e, by-ext",
+					Usage: "print the count for each file extension",
+				},
+				cli.BoolFlag{
+					Name:  "s, stats",
+					Usage: "print size statistics, retaining one size per file",
+				},
+				cli.BoolFlag{
+					Name:  "W, watch",
+					Usage: "recount and reprint the counts whenever files change, until interrupted",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "histogram",
+			Usage:     "compute the distribution of file sizes",
+			ArgsUsage: "dir [dir ...]",
+			Action:    histogram,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "b, buckets",
+					Value: "",
+					Usage: "comma separated bucket sizes, e.g. 1K,1M,100M",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "treestats",
+			Usage:     "report the depth of files and the number of files per directory",
+			ArgsUsage: "dir [dir ...]",
+			Action:    treestats,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the statistics as JSON",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "dedup",
+			Usage:     "find groups of files with identical contents",
+			ArgsUsage: "dir [dir ...]",
+			Action:    dedup,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "head-bytes",
+					Usage: "only hash the first bytes of each file for approximate duplicates, e.g. 1M",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "checksum",
+			Usage:     "print the digest of the contents of every file",
+			ArgsUsage: "dir [dir ...]",
+			Action:    checksum,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "a, algorithm",
+					Value: "sha256",
+					Usage: "hash algorithm to use (md5, sha1, sha256)",
+				},
+				cli.StringFlag{
+					Name:  "head-bytes",
+					Usage: "only hash the first bytes of each file, e.g. 1M",
+				},
+			},
+			Subcommands: []cli.Command{
+				cli.Command{
+					Name:      "write",
+					Usage:     "write a sorted SHA-256 manifest of the files in dir",
+					ArgsUsage: "dir manifest",
+					Action:    checksumWrite,
+				},
+				cli.Command{
+					Name:      "verify",
+					Usage:     "print the files in dir that no longer match a SHA-256 manifest",
+					ArgsUsage: "dir manifest",
+					Action:    checksumVerify,
+				},
+			},
+		},
+		cli.Command{
+			Name:      "treehash",
+			Usage:     "print a single digest of the contents of each directory tree",
+			ArgsUsage: "dir [dir ...]",
+			Action:    treehash,
+		},
+		cli.Command{
+			Name:      "index",
+			Usage:     "record the path, size, modification time, and hash of every file in a SQLite database",
+			ArgsUsage: "db dir [dir ...]",
+			Action:    index,
+		},
+		cli.Command{
+			Name:      "newest",
+			Usage:     "print the most recently modified files",
+			ArgsUsage: "dir [dir ...]",
+			Action:    newest,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "c, count",
+					Value: 10,
+					Usage: "number of files to print",
+				},
+				cli.BoolFlag{
+					Name:  "o, oldest",
+					Usage: "print the least recently modified files instead",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "largest",
+			Usage:     "print the biggest files and their sizes",
+			ArgsUsage: "dir [dir ...]",
+			Action:    largest,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "c, count",
+					Value: 10,
+					Usage: "number of files to print",
+				},
+				cli.BoolFlag{
+					Name:  "s, smallest",
+					Usage: "print the smallest files instead",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "list",
+			Usage:     "print the paths selected by the current filters",
+			ArgsUsage: "dir [dir ...]",
+			Action:    list,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "0, null",
+					Usage: "separate paths with a null character for xargs -0",
+				},
+				cli.StringFlag{
+					Name:  "ext",
+					Usage: "only process files with these comma separated extensions, e.g. mp4,mkv",
+				},
+				cli.StringFlag{
+					Name:  "exclude-ext",
+					Usage: "skip files with these comma separated extensions, e.g. log,tmp",
+				},
+				cli.BoolFlag{
+					Name:  "v, invert",
+					Usage: "print the files that do not match the pattern or extensions",
+				},
+				cli.BoolFlag{
+					Name:  "jsonl",
+					Usage: "print a JSON object with the path, size, and modtime of each file per line",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "search",
+			Usage:     "print paths that match a regular expression",
+			ArgsUsage: "pattern dir [dir ...]",
+			Action:    search,
+		},
+		cli.Command{
+			Name:      "run",
+			Usage:     "apply a registered operation to every file, e.g. count, hash or sample",
+			ArgsUsage: "name dir [dir ...]",
+			Action:    run,
 		},
 	}
 
-	// Run the application
-	app.Run(os.Args)
+	return app
 }
 
 //===========================================================================
@@ -97,52 +603,1427 @@ func initWalker(c *cli.Context) (err error) {
 		}
 	}
 
+	// Parse the timeout for processing each file
+	var fileTimeout time.Duration
+	if c.String("file-timeout") != "" {
+		if fileTimeout, err = time.ParseDuration(c.String("file-timeout")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
 	// Create the context for the walk function
 	ctx := context.Background()
 	if timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	// Open the log file, appending so that repeated runs accumulate history
+	if path := c.String("log"); path != "" {
+		if logFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		logger = log.New(logFile, "", log.LstdFlags)
 	}
 
-	// Initialize the walker
+	// Initialize the walker, resetting it with the size of the buffer
 	fs = new(urfs.FSWalker)
 	fs.Init(ctx)
+	if c.Int("buffer") != fs.Buffer {
+		fs.Buffer = c.Int("buffer")
+		fs.Reset(ctx)
+	}
+
+	// Stop the walk cleanly on the first interrupt; a second interrupt exits
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		fs.Cancel()
+	}()
+
+	// Parse the size range of files to process
+	if c.String("min-size") != "" {
+		if fs.MinSize, err = urfs.ParseBytes(c.String("min-size")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	if c.String("max-size") != "" {
+		if fs.MaxSize, err = urfs.ParseBytes(c.String("max-size")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Parse the maximum rate of copies
+	if c.String("rate-limit") != "" {
+		if fs.RateLimit, err = urfs.ParseBytes(c.String("rate-limit")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Parse the modification time range of files to process
+	now := time.Now()
+	if c.String("modified-after") != "" {
+		if fs.ModifiedAfter, err = urfs.ParseTime(c.String("modified-after"), now); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	if c.String("modified-before") != "" {
+		if fs.ModifiedBefore, err = urfs.ParseTime(c.String("modified-before"), now); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
 
 	// Set other defaults from the command line
 	fs.Workers = c.Int("workers")
+	fs.DirWorkers = c.Int("dir-workers")
+	fs.Output = stdout
+	if c.Bool("verbose") {
+		fs.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
 	fs.SkipDirs = !c.Bool("no-skip-dirs")
 	fs.SkipHidden = !c.Bool("no-skip-hidden")
-	fs.Match = c.String("match")
+	if c.String("include-hidden") != "" {
+		fs.IncludeHidden = strings.Split(c.String("include-hidden"), ",")
+	}
+
+	fs.HiddenPrefixes = c.StringSlice("hidden-prefix")
+	fs.SkipDirNames = c.StringSlice("skip-dir")
+	fs.Patterns = c.StringSlice("match")
+	fs.MatchPath = c.Bool("match-path")
+	fs.IgnoreCase = c.Bool("ignore-case")
+	fs.Exclude = c.String("exclude")
+	if c.String("mime") != "" {
+		fs.MimeTypes = strings.Split(c.String("mime"), ",")
+	}
+	fs.MaxDepth = c.Int("max-depth")
+	fs.Seed = c.Int64("seed")
+	fs.FollowSymlinks = c.Bool("follow-symlinks")
+	fs.SkipPermissionErrors = c.Bool("skip-denied")
+	fs.Sorted = c.Bool("sorted")
+	fs.Profile = c.Bool("profile")
+	fs.FileTimeout = fileTimeout
 
 	return nil
 }
 
-//===========================================================================
-// Sample Command
-//===========================================================================
+// Set the extensions of the files to process and to skip from the command's
+// --ext and --exclude-ext flags.
+func setExtensions(c *cli.Context) {
+	if c.String("ext") != "" {
+		fs.Extensions = strings.Split(c.String("ext"), ",")
+	}
 
-func sample(c *cli.Context) error {
-	if c.NArg() != 2 {
-		return cli.NewExitError("specify the src and dst directories", 1)
+	if c.String("exclude-ext") != "" {
+		fs.ExcludeExtensions = strings.Split(c.String("exclude-ext"), ",")
 	}
+}
 
-	args := c.Args()
-	result, err := fs.Sample(args.Get(0), args.Get(1), c.Float64("sample"))
-	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+// Set the number of bytes hashed at the head of each file from the command's
+// --head-bytes flag, which is a human readable size such as 1M.
+func setHeadBytes(c *cli.Context) (err error) {
+	if c.String("head-bytes") != "" {
+		if fs.HeadBytes, err = urfs.ParseBytes(c.String("head-bytes")); err != nil {
+			return err
+		}
+
+		if fs.HeadBytes <= 0 {
+			return fmt.Errorf("head bytes must be positive, got %q", c.String("head-bytes"))
+		}
+	}
+	return nil
+}
+
+// Writer that writes each write as a line of the log with a timestamp.
+type logWriter struct {
+	*log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.Print(string(p))
+	return len(p), nil
+}
+
+// Returns the writer for the results of the sample and count commands, which
+// are also appended to the log if the --log flag is specified.
+func resultWriter() io.Writer {
+	if logger == nil {
+		return stdout
+	}
+	return io.MultiWriter(stdout, logWriter{logger})
+}
+
+// Wrap the action so that any error it returns is also written to the log.
+func logged(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		err := action(c)
+		if err != nil && logger != nil {
+			logger.Printf("error: %s", err)
+		}
+		return err
+	}
+}
+
+// Release the resources associated with the walker and its timeout.
+func closeWalker(c *cli.Context) error {
+	if fs != nil {
+		if profile := fs.WalkProfile(); profile != nil {
+			fmt.Fprintln(os.Stderr, profile)
+		}
+		fs.Close()
+	}
+
+	if logFile != nil {
+		logFile.Close()
 	}
 
-	fmt.Println(result)
+	if cancel != nil {
+		cancel()
+	}
 	return nil
 }
 
 //===========================================================================
-// Count Command
+// Root Paths
 //===========================================================================
 
-func count(c *cli.Context) error {
-	_, err := fs.Count(true, c.Args()...)
-	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+// Returns the root paths to walk from the arguments, replacing any argument
+// of "-" with the paths read from stdin and appending the paths read from
+// the --paths-from file if specified.
+func roots(c *cli.Context, args []string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "-" {
+			paths = append(paths, arg)
+			continue
+		}
+
+		piped, err := urfs.ReadPaths(stdin)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, piped...)
+	}
+
+	if c.GlobalString("paths-from") != "" {
+		file, err := readPaths(c.GlobalString("paths-from"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, file...)
+	}
+
+	return paths, nil
+}
+
+// Read the newline separated paths from the named file, or from stdin if
+// the name is "-".
+func readPaths(name string) ([]string, error) {
+	if name == "-" {
+		return urfs.ReadPaths(stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return urfs.ReadPaths(f)
+}
+
+//===========================================================================
+// Progress
+//===========================================================================
+
+// Sets the walker to print a progress line to stderr, updated in place, and
+// returns a function that terminates the progress line when done.
+func showProgress() func() {
+	fs.OnProgress = func(paths, results uint64) {
+		fmt.Fprintf(os.Stderr, "\r%d results of %d paths", results, paths)
+	}
+
+	return func() {
+		fs.OnProgress = nil
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// Shows the progress of copying large files on stderr during a sample,
+// returning a function that stops showing the progress.
+func showCopyProgress() func() {
+	var mu sync.Mutex
+	fs.OnCopy = func(path string, copied, total int64) {
+		if total < urfs.ProgressBytes {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(
+			os.Stderr, "\r%s: copied %s of %s\033[K",
+			path, urfs.HumanizeBytes(uint64(copied)), urfs.HumanizeBytes(uint64(total)),
+		)
+		if copied >= total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+
+	return func() {
+		fs.OnCopy = nil
+	}
+}
+
+//===========================================================================
+// Sample Command
+//===========================================================================
+
+func sample(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError("specify the src and dst directories", 1)
+	}
+
+	if c.String("archive") != "" {
+		return sampleArchive(c)
+	}
+
+	if c.Bool("weighted") && c.Int("count") < 1 {
+		return cli.NewExitError("a size-weighted sample requires the number of files to select with --count", 1)
+	}
+
+	// The destination is the last argument, all others are sources
+	args := c.Args()
+	dst := args.Get(c.NArg() - 1)
+	srcs, err := roots(c, args[:c.NArg()-1])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(srcs) == 0 {
+		return cli.NewExitError("specify the src and dst directories", 1)
+	}
+
+	if c.Bool("progress") {
+		defer showProgress()()
+		defer showCopyProgress()()
+	}
+
+	fs.Preserve = c.Bool("preserve")
+	fs.DryRun = c.Bool("dry-run")
+	fs.Flatten = c.Bool("flatten")
+	fs.PreservePath = c.Bool("preserve-path")
+	if c.String("max-bytes") != "" {
+		if fs.MaxBytes, err = urfs.ParseBytes(c.String("max-bytes")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	if format := c.String("rename"); format != "" {
+		if fs.Rename, err = urfs.RenameTemplate(format); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	fs.Gzip = c.Bool("gzip")
+	fs.Sync = c.Bool("sync")
+	fs.Overwrite = !c.Bool("no-overwrite")
+	fs.Unique = c.Bool("unique")
+	fs.CopyRetries = c.Int("copy-retries")
+	setExtensions(c)
+
+	if path := c.String("manifest"); path != "" {
+		if fs.Manifest, err = urfs.NewManifest(path); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Resume the sample from the state file if it exists
+	if path := c.String("state"); path != "" {
+		if fs.State, err = urfs.OpenSampleState(path); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer fs.State.Close()
+	}
+
+	// Sample each of the sources; if there are multiple sources, each one is
+	// sampled into a directory in dst named after the base of the source.
+	var found, sampled uint64
+	for _, src := range srcs {
+		var result string
+		target := dst
+		if len(srcs) > 1 {
+			target = filepath.Join(dst, filepath.Base(src))
+		}
+
+		if c.Int("count") > 0 {
+			if c.Bool("weighted") {
+				result, err = fs.SampleWeighted(src, target, c.Int("count"))
+			} else {
+				result, err = fs.SampleN(src, target, c.Int("count"))
+			}
+		} else if c.Bool("stratified") {
+			result, err = fs.SampleStratified(src, target, c.Float64("sample"))
+		} else {
+			result, err = fs.Sample(src, target, c.Float64("sample"))
+		}
+
+		if len(srcs) > 1 && result != "" {
+			result = fmt.Sprintf("%s: %s", src, result)
+		}
+
+		if err != nil {
+			// Print the partial summary of a sample interrupted by a timeout
+			if result != "" {
+				fmt.Fprintln(resultWriter(), result)
+			}
+
+			// Keep the record of the files copied before the error
+			if fs.Manifest != nil {
+				fs.Manifest.Close()
+			}
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Fprintln(resultWriter(), result)
+		found += fs.NumPaths()
+		sampled += fs.NumResults()
+	}
+
+	// Close the manifest only after all of the copies are complete
+	if fs.Manifest != nil {
+		if err := fs.Manifest.Close(); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Fprintf(resultWriter(), "wrote %d files to manifest %s\n", fs.Manifest.Count, fs.Manifest.Path)
+	}
+
+	return requireFiles(c, "sample", found, sampled)
+}
+
+// Returns an exit error if the --require-files flag is set and the walk found
+// no files or the operation produced no results, since in an automated
+// pipeline an empty walk usually means the wrong directory or filters that
+// are too strict rather than an empty directory.
+func requireFiles(c *cli.Context, action string, found, results uint64) error {
+	if !c.Bool("require-files") {
+		return nil
+	}
+
+	switch {
+	case found == 0:
+		return cli.NewExitError(fmt.Sprintf("%s found no files, check the directories and filters", action), 1)
+	case results == 0:
+		return cli.NewExitError(fmt.Sprintf("%s selected none of the %d files found, check the filters and sample size", action, found), 1)
+	default:
+		return nil
+	}
+}
+
+func sampleArchive(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.NewExitError("specify the src directory to archive", 1)
+	}
+
+	if c.Bool("progress") {
+		defer showProgress()()
+	}
+
+	fs.DryRun = c.Bool("dry-run")
+	result, err := fs.SampleArchive(c.Args().First(), c.String("archive"), c.Float64("sample"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintln(resultWriter(), result)
+	return nil
+}
+
+//===========================================================================
+// Move Command
+//===========================================================================
+
+func move(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("specify the src and dst directories", 1)
+	}
+
+	args := c.Args()
+	if !c.Bool("yes") && interactive() {
+		// Fix the seed so that the move selects the files that were counted
+		if fs.Seed == 0 {
+			fs.Seed = time.Now().UnixNano()
+		}
+
+		count, err := fs.CountMove(args.Get(0), c.Float64("sample"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		prompt := fmt.Sprintf("About to move %d files (%s), continue?", count.Files, urfs.HumanizeBytes(count.Bytes))
+		if !confirm(prompt) {
+			return cli.NewExitError("move aborted", 1)
+		}
+	}
+
+	result, err := fs.Move(args.Get(0), args.Get(1), c.Float64("sample"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintln(stdout, result)
+
+	if c.Bool("prune-empty") {
+		removed, err := fs.PruneEmpty(args.Get(0))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Fprintf(stdout, "removed %d empty directories from %s\n", len(removed), args.Get(0))
+	}
+	return nil
+}
+
+// Returns true if both stdin and stdout are terminals, so that the user can
+// be asked to confirm destructive operations.
+func interactive() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Asks the user to confirm the prompt, reading the answer from stdin. The
+// prompt is written to stderr so that it does not mix with the results on
+// stdout. Returns true only if the answer is y or yes; no answer means no.
+func confirm(prompt string) bool {
+	fmt.Fprintf(stderr, "%s [y/N] ", prompt)
+
+	answer, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+//===========================================================================
+// Prune Command
+//===========================================================================
+
+func prune(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if !c.Bool("yes") && !c.Bool("dry-run") && interactive() {
+		fs.DryRun = true
+		empty, err := fs.PruneEmpty(paths...)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if len(empty) == 0 {
+			return nil
+		}
+
+		if !confirm(fmt.Sprintf("About to remove %d empty directories, continue?", len(empty))) {
+			return cli.NewExitError("prune aborted", 1)
+		}
+	}
+
+	fs.DryRun = c.Bool("dry-run")
+	removed, err := fs.PruneEmpty(paths...)
+	for _, path := range removed {
+		fmt.Fprintln(stdout, path)
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+//===========================================================================
+// Verify Command
+//===========================================================================
+
+func verify(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("specify the src and dst directories", 1)
+	}
+
+	args := c.Args()
+	result, err := fs.VerifyFiles(args.Get(0), args.Get(1))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, path := range result.Mismatched {
+		fmt.Fprintf(stdout, "mismatched: %s\n", path)
+	}
+
+	for _, path := range result.Missing {
+		fmt.Fprintf(stdout, "missing from src: %s\n", path)
+	}
+
+	fmt.Fprintf(
+		stdout, "verified %d files, %d mismatched, %d missing from src\n",
+		result.Verified, len(result.Mismatched), len(result.Missing),
+	)
+
+	if len(result.Mismatched) > 0 || len(result.Missing) > 0 {
+		return cli.NewExitError("verification failed", 1)
+	}
+	return nil
+}
+
+//===========================================================================
+// Count Command
+//===========================================================================
+
+func count(c *cli.Context) error {
+	if c.String("files-from") != "" {
+		if c.Bool("watch") {
+			return cli.NewExitError("cannot watch the files listed by --files-from", 1)
+		}
+		return countFiles(c)
+	}
+
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fs.IncludeEmpty = !c.Bool("no-empty")
+	fs.DedupHardlinks = c.Bool("dedup-links")
+	fs.DiskUsage = c.Bool("disk-usage")
+	fs.IntoArchives = c.Bool("into-archives")
+	setExtensions(c)
+
+	if c.Bool("watch") {
+		return watch(paths, func() error {
+			return countPaths(c, paths)
+		})
+	}
+	return countPaths(c, paths)
+}
+
+// Counts the files and bytes in the paths once, printing the counts as
+// specified by the flags of the count command.
+func countPaths(c *cli.Context, paths []string) (err error) {
+	if c.Bool("progress") {
+		defer showProgress()()
+	}
+
+	if c.Bool("by-ext") {
+		return countByExt(c, paths)
+	}
+
+	if c.Bool("stats") {
+		return countStats(c, paths)
+	}
+
+	// Print each count as it completes unless quiet, sorting, or printing
+	// JSON or raw bytes; when logging, the counts are written once they are
+	// complete.
+	quiet := c.Bool("quiet")
+	order := c.String("sort") != "" || c.Bool("reverse")
+	if key := c.String("sort"); key != "" {
+		// Validate the sort key before counting
+		if err := urfs.SortDirSizes(nil, key, false); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Parse the format before counting so a bad template fails immediately
+	var format *template.Template
+	if c.String("format") != "" {
+		if format, err = urfs.ParseSizeFormat(c.String("format")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	print := !quiet && !order && !c.Bool("json") && !c.Bool("bytes") && format == nil && logger == nil
+
+	var sizes []*urfs.DirSize
+	if c.Bool("parallel") {
+		sizes, err = fs.CountParallel(print, paths...)
+	} else {
+		sizes, err = fs.Count(print, paths...)
+	}
+
+	// Print the partial counts if the walk was interrupted
+	canceled := err == context.Canceled
+	if err != nil && !canceled {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	counted := urfs.SumDirSizes(sizes).Files
+
+	// Order the counts if required, reversing the input order if no key
+	if order {
+		if key := c.String("sort"); key != "" {
+			urfs.SortDirSizes(sizes, key, c.Bool("reverse"))
+		} else {
+			for i, j := 0, len(sizes)-1; i < j; i, j = i+1, j-1 {
+				sizes[i], sizes[j] = sizes[j], sizes[i]
+			}
+		}
+	}
+
+	var total *urfs.DirSize
+	if c.Bool("total") {
+		total = urfs.SumDirSizes(sizes)
+	}
+
+	// Only the total is output when quiet
+	if quiet {
+		sizes = nil
+	}
+
+	switch {
+	case c.Bool("json"):
+		if sizes == nil {
+			sizes = make([]*urfs.DirSize, 0, 1)
+		}
+
+		if total != nil {
+			sizes = append(sizes, total)
+		}
+
+		if err := json.NewEncoder(resultWriter()).Encode(sizes); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	case c.Bool("bytes"):
+		for _, size := range sizes {
+			fmt.Fprintln(resultWriter(), size.RawString())
+		}
+
+		if total != nil {
+			fmt.Fprintln(resultWriter(), total.RawString())
+		}
+	case format != nil:
+		if total != nil {
+			sizes = append(sizes, total)
+		}
+
+		for _, size := range sizes {
+			out, err := size.Format(format)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			fmt.Fprintln(resultWriter(), out)
+		}
+	default:
+		if !print {
+			for _, size := range sizes {
+				fmt.Fprintln(resultWriter(), size.String())
+			}
+		}
+
+		if total != nil {
+			fmt.Fprintln(resultWriter(), total.String())
+		}
+	}
+
+	if canceled {
+		return cli.NewExitError("count interrupted, partial counts shown", 130)
+	}
+
+	return requireFiles(c, "count", counted, counted)
+}
+
+//===========================================================================
+// Watch Mode
+//===========================================================================
+
+// How long the file system must be quiet after a change before the watched
+// operation is run again, so that a burst of changes causes a single rerun.
+const watchDelay = 500 * time.Millisecond
+
+// Clears the terminal and moves the cursor to the top left corner.
+const clearScreen = "\033[H\033[2J"
+
+// Runs the function, then watches the directory trees rooted at the paths
+// and clears the screen and runs the function again whenever files change,
+// until interrupted. Errors from the watcher and from reruns are reported to
+// stderr without stopping the watch, unless the rerun was interrupted.
+func watch(paths []string, run func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer watcher.Close()
+
+	for _, path := range paths {
+		if err := watchTree(watcher, path); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// The walker is also canceled on interrupt, so an interrupted run
+	// returns an error and the interrupt is waiting on this channel.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	if err := run(); err != nil {
+		return err
+	}
+
+	changes := make(chan struct{})
+	defer close(changes)
+	refresh := debounce(changes, watchDelay)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// Watch directories created inside of the trees; the path may
+			// already be gone or be a file, so errors are ignored.
+			if event.Op&fsnotify.Create != 0 {
+				watchTree(watcher, event.Name)
+			}
+			changes <- struct{}{}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "watch error: %s\n", err)
+
+		case <-refresh:
+			fmt.Fprint(stdout, clearScreen)
+			if err := run(); err != nil {
+				select {
+				case <-interrupt:
+					return err
+				default:
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// Adds the directory at the path and every directory below it to the
+// watcher, since changes are only reported for the directories watched.
+func watchTree(watcher *fsnotify.Watcher, path string) error {
+	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// Returns a channel that receives a value once no events have been received
+// for the delay since the last event, coalescing a burst of events into a
+// single value. A value is only buffered if it has not been received yet, so
+// events that arrive while the caller is busy cause at most one more value.
+// The returned channel is closed, dropping any pending value, when the
+// events channel is closed.
+func debounce(events <-chan struct{}, delay time.Duration) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	go func() {
+		defer close(out)
+
+		timer := time.NewTimer(delay)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+
+				// Drain a value from a timer that fired while the event was
+				// received so that it does not cause an early refresh.
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+
+			case <-timer.C:
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return out
+}
+
+//===========================================================================
+// Run Command
+//===========================================================================
+
+func run(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError(
+			"specify an operation, one of "+strings.Join(urfs.RegisteredWalkFuncs(), ", "), 1,
+		)
+	}
+
+	walkFn, err := fs.LookupWalkFunc(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	paths, err := roots(c, c.Args().Tail())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(paths) == 0 {
+		return cli.NewExitError("specify at least one directory", 1)
+	}
+
+	// Print the results of the operation as they are streamed from the walk
+	out := make(chan string, urfs.DefaultBuffer)
+	done := make(chan struct{})
+	w := bufio.NewWriter(stdout)
+
+	go func() {
+		for result := range out {
+			fmt.Fprintln(w, result)
+		}
+		close(done)
+	}()
+
+	for _, path := range paths {
+		if err = fs.WalkStream(path, walkFn, out); err != nil {
+			break
+		}
+	}
+
+	close(out)
+	<-done
+
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+//===========================================================================
+// Search Command
+//===========================================================================
+
+func search(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.NewExitError("specify a pattern and at least one directory", 1)
+	}
+
+	args := c.Args()
+	paths, err := roots(c, args.Tail())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if _, err = fs.Search(args.First(), true, paths...); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+func countByExt(c *cli.Context, paths []string) error {
+	exts, err := fs.CountByExt(paths...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
 	}
+
+	// Sort the extensions by number of bytes descending
+	sizes := make([]*urfs.DirSize, 0, len(exts))
+	for _, size := range exts {
+		sizes = append(sizes, size)
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes == sizes[j].Bytes {
+			return sizes[i].Path < sizes[j].Path
+		}
+		return sizes[i].Bytes > sizes[j].Bytes
+	})
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(resultWriter()).Encode(sizes); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	for _, size := range sizes {
+		if c.Bool("bytes") {
+			fmt.Fprintf(resultWriter(), "%-12s %10d files %16d bytes\n", size.Path, size.Files, size.Bytes)
+		} else {
+			fmt.Fprintf(resultWriter(), "%-12s %10d files %12s\n", size.Path, size.Files, urfs.HumanizeBytes(size.Bytes))
+		}
+	}
+	return nil
+}
+
+func countFiles(c *cli.Context) error {
+	paths, err := readPaths(c.String("files-from"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("progress") {
+		defer showProgress()()
+	}
+
+	fs.IncludeEmpty = !c.Bool("no-empty")
+	fs.DedupHardlinks = c.Bool("dedup-links")
+	fs.DiskUsage = c.Bool("disk-usage")
+	fs.IntoArchives = c.Bool("into-archives")
+
+	size, err := fs.CountFiles(paths)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	switch {
+	case c.Bool("json"):
+		if err := json.NewEncoder(resultWriter()).Encode(size); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	case c.Bool("bytes"):
+		fmt.Fprintln(resultWriter(), size.RawString())
+	default:
+		fmt.Fprintln(resultWriter(), size.String())
+	}
+	return nil
+}
+
+func countStats(c *cli.Context, paths []string) error {
+	stats, err := fs.CountStats(paths...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(resultWriter()).Encode(stats); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	fmt.Fprintln(resultWriter(), stats.String())
+	return nil
+}
+
+//===========================================================================
+// Histogram Command
+//===========================================================================
+
+func histogram(c *cli.Context) error {
+	// Parse the bucket sizes if specified
+	var buckets []int64
+	if c.String("buckets") != "" {
+		for _, val := range strings.Split(c.String("buckets"), ",") {
+			size, err := urfs.ParseBytes(val)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			buckets = append(buckets, size)
+		}
+	}
+
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	hist, err := fs.Histogram(buckets, paths...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintln(stdout, hist.String())
+	return nil
+}
+
+//===========================================================================
+// Tree Stats Command
+//===========================================================================
+
+func treestats(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(paths) == 0 {
+		return cli.NewExitError("specify at least one directory", 1)
+	}
+
+	shapes := make([]*urfs.TreeShape, 0, len(paths))
+	for _, path := range paths {
+		shape, err := fs.TreeStats(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		shapes = append(shapes, shape)
+	}
+
+	if c.Bool("json") {
+		if err := json.NewEncoder(stdout).Encode(shapes); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	for _, shape := range shapes {
+		fmt.Fprintln(stdout, shape.String())
+	}
+	return nil
+}
+
+//===========================================================================
+// Newest Command
+//===========================================================================
+
+func newest(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var files []string
+	if c.Bool("oldest") {
+		files, err = fs.Oldest(c.Int("count"), paths...)
+	} else {
+		files, err = fs.Newest(c.Int("count"), paths...)
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, path := range files {
+		fmt.Fprintln(stdout, path)
+	}
+	return nil
+}
+
+//===========================================================================
+// Largest Command
+//===========================================================================
+
+func largest(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var sizes []*urfs.FileSize
+	if c.Bool("smallest") {
+		sizes, err = fs.Smallest(c.Int("count"), paths...)
+	} else {
+		sizes, err = fs.Largest(c.Int("count"), paths...)
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, size := range sizes {
+		fmt.Fprintln(stdout, size.String())
+	}
+	return nil
+}
+
+//===========================================================================
+// List Command
+//===========================================================================
+
+func list(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fs.Invert = c.Bool("invert")
+	setExtensions(c)
+
+	if c.Bool("jsonl") {
+		return listJSONL(paths)
+	}
+
+	sep := "\n"
+	if c.Bool("null") {
+		sep = "\x00"
+	}
+
+	// Print the paths as they are streamed from the walk
+	out := make(chan string, urfs.DefaultBuffer)
+	done := make(chan struct{})
+	w := bufio.NewWriter(stdout)
+
+	go func() {
+		for path := range out {
+			w.WriteString(path)
+			w.WriteString(sep)
+		}
+		close(done)
+	}()
+
+	for _, path := range paths {
+		if err = fs.WalkStream(path, func(path string) (string, error) {
+			return path, nil
+		}, out); err != nil {
+			break
+		}
+	}
+
+	close(out)
+	<-done
+
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+// Print the entry of each file as a JSON object per line as they are
+// streamed from the walk, flushing each line so that downstream consumers
+// receive the entries as they are discovered.
+func listJSONL(paths []string) (err error) {
+	out := make(chan string, urfs.DefaultBuffer)
+	done := make(chan error)
+	w := bufio.NewWriter(stdout)
+
+	go func() {
+		var werr error
+		for entry := range out {
+			if werr == nil {
+				if _, werr = fmt.Fprintln(w, entry); werr == nil {
+					werr = w.Flush()
+				}
+			}
+		}
+		done <- werr
+	}()
+
+	for _, path := range paths {
+		if err = fs.WalkStream(path, fs.EntryWalkFunc(), out); err != nil {
+			break
+		}
+	}
+
+	close(out)
+	if werr := <-done; err == nil {
+		err = werr
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+//===========================================================================
+// Dedup Command
+//===========================================================================
+
+func dedup(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := setHeadBytes(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	groups, err := fs.Duplicates(paths...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	// Print the groups in a deterministic order
+	digests := make([]string, 0, len(groups))
+	for digest := range groups {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+
+	for _, digest := range digests {
+		paths := groups[digest]
+		sort.Strings(paths)
+
+		fmt.Fprintln(stdout, digest)
+		for _, path := range paths {
+			fmt.Fprintf(stdout, "  %s\n", path)
+		}
+	}
+	return nil
+}
+
+//===========================================================================
+// Checksum Command
+//===========================================================================
+
+func checksum(c *cli.Context) error {
+	var h func() hash.Hash
+	switch c.String("algorithm") {
+	case "md5":
+		h = md5.New
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	default:
+		return cli.NewExitError(fmt.Sprintf("unknown hash algorithm %q", c.String("algorithm")), 1)
+	}
+
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := setHeadBytes(c); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var mu sync.Mutex
+	digests := make(map[string]string)
+	for _, path := range paths {
+		if err := fs.Walk(path, urfs.HashHeadWalkFunc(h, fs.HeadBytes, digests, &mu)); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Print the digests in a deterministic order
+	files := make([]string, 0, len(digests))
+	for path := range digests {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		fmt.Fprintf(stdout, "%s  %s\n", digests[path], path)
+	}
+	return nil
+}
+
+func checksumWrite(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("specify the dir and the manifest to write", 1)
+	}
+
+	args := c.Args()
+	if err := fs.WriteChecksums(args.Get(0), args.Get(1)); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintf(stdout, "wrote checksums of %d files to %s\n", fs.NumResults(), args.Get(1))
+	return nil
+}
+
+func checksumVerify(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("specify the dir and the manifest to verify", 1)
+	}
+
+	args := c.Args()
+	mismatched, err := fs.VerifyChecksums(args.Get(0), args.Get(1))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, path := range mismatched {
+		fmt.Fprintf(stdout, "mismatched: %s\n", path)
+	}
+
+	if len(mismatched) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d of %d files do not match the manifest", len(mismatched), fs.NumPaths()), 1)
+	}
+
+	fmt.Fprintf(stdout, "verified %d files\n", fs.NumPaths())
+	return nil
+}
+
+//===========================================================================
+// Treehash Command
+//===========================================================================
+
+func treehash(c *cli.Context) error {
+	paths, err := roots(c, c.Args())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(paths) == 0 {
+		return cli.NewExitError("specify at least one directory", 1)
+	}
+
+	for _, path := range paths {
+		digest, err := fs.TreeHash(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Fprintf(stdout, "%s  %s\n", digest, path)
+	}
+	return nil
+}
+
+//===========================================================================
+// Index Command
+//===========================================================================
+
+func index(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.NewExitError("specify the database and the directories to index", 1)
+	}
+
+	paths, err := roots(c, c.Args().Tail())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	db, err := openIndex(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer db.Close()
+
+	result, err := fs.Index(db, paths...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintln(stdout, result)
 	return nil
 }
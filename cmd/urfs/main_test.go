@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/urfs"
+	"github.com/urfave/cli"
+)
+
+func TestConfirm(t *testing.T) {
+	in, out, errw := stdin, stdout, stderr
+	defer func() { stdin, stdout, stderr = in, out, errw }()
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"y", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+		{"maybe\n", false},
+	}
+
+	for _, tc := range tests {
+		var buf, results bytes.Buffer
+		stdin, stdout, stderr = strings.NewReader(tc.input), &results, &buf
+
+		if confirm("About to move 2 files (2 B), continue?") != tc.expected {
+			t.Errorf("input %q: expected %t", tc.input, tc.expected)
+		}
+
+		if prompt := buf.String(); prompt != "About to move 2 files (2 B), continue? [y/N] " {
+			t.Errorf("unexpected prompt %q", prompt)
+		}
+
+		if results.Len() != 0 {
+			t.Errorf("expected no prompt on stdout, got %q", results.String())
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	in := stdin
+	defer func() { stdin = in }()
+
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "paths.txt")
+	if err := ioutil.WriteFile(path, []byte("from/file\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	set := flag.NewFlagSet("urfs", flag.ContinueOnError)
+	set.String("paths-from", "", "")
+	c := cli.NewContext(nil, set, nil)
+
+	// A "-" argument is replaced with the paths read from stdin
+	stdin = strings.NewReader("from/stdin/a\n# comment\nfrom/stdin/b\n")
+	paths, err := roots(c, []string{"arg", "-"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"arg", "from/stdin/a", "from/stdin/b"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	// The --paths-from file is appended, and may also be read from stdin
+	set.Set("paths-from", path)
+	if paths, err = roots(c, []string{"arg"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"arg", "from/file"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	stdin = strings.NewReader("from/stdin\n")
+	set.Set("paths-from", "-")
+	if paths, err = roots(c, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"from/stdin"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	events := make(chan struct{})
+	refresh := debounce(events, 50*time.Millisecond)
+
+	// A burst of events closer together than the delay causes one refresh
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		events <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-refresh:
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("refreshed after %s, before the burst was over", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a refresh after the burst of events")
+	}
+
+	select {
+	case <-refresh:
+		t.Error("expected only one refresh for the burst of events")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// Bursts that are not received are coalesced into a single refresh
+	events <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	events <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+
+	<-refresh
+	select {
+	case <-refresh:
+		t.Error("expected unreceived refreshes to be coalesced")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// Events just further apart than the delay cause at most one refresh each,
+	// even when the timer fires as the next event is received.
+	var refreshes int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range refresh {
+			refreshes++
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		events <- struct{}{}
+		time.Sleep(51 * time.Millisecond)
+	}
+
+	// Closing the events closes the refresh channel
+	close(events)
+	select {
+	case <-done:
+		if refreshes > 20 {
+			t.Errorf("expected at most 20 refreshes for 20 events, got %d", refreshes)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the refresh channel to be closed")
+	}
+}
+
+func TestDebounceClose(t *testing.T) {
+	events := make(chan struct{})
+	refresh := debounce(events, 50*time.Millisecond)
+
+	// Closing the events closes the refresh channel
+	close(events)
+	select {
+	case _, ok := <-refresh:
+		if ok {
+			t.Error("expected the refresh channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the refresh channel to be closed")
+	}
+}
+
+func TestRequireFiles(t *testing.T) {
+	set := flag.NewFlagSet("sample", flag.ContinueOnError)
+	set.Bool("require-files", false, "")
+	c := cli.NewContext(nil, set, nil)
+
+	// Nothing is required unless the flag is set
+	if err := requireFiles(c, "sample", 0, 0); err != nil {
+		t.Errorf("expected no error without --require-files, got %s", err)
+	}
+
+	set.Set("require-files", "true")
+	tests := []struct {
+		found, results uint64
+		message        string
+	}{
+		{0, 0, "sample found no files, check the directories and filters"},
+		{10, 0, "sample selected none of the 10 files found, check the filters and sample size"},
+		{10, 1, ""},
+	}
+
+	for _, tc := range tests {
+		err := requireFiles(c, "sample", tc.found, tc.results)
+		if tc.message == "" {
+			if err != nil {
+				t.Errorf("expected no error with %d results, got %s", tc.results, err)
+			}
+			continue
+		}
+
+		exit, ok := err.(*cli.ExitError)
+		if !ok {
+			t.Errorf("expected an exit error with %d files found and %d results, got %v", tc.found, tc.results, err)
+			continue
+		}
+
+		if exit.ExitCode() != 1 || exit.Error() != tc.message {
+			t.Errorf("expected exit code 1 with %q, got %d with %q", tc.message, exit.ExitCode(), exit.Error())
+		}
+	}
+}
+
+// Helper function that creates a temporary directory containing the files,
+// mapping the relative path of each file to its contents.
+func makeTree(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return root
+}
+
+func TestCountOutput(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aa", "sub/b.txt": "bbb", "sub/c.log": "c"})
+	defer os.RemoveAll(root)
+
+	out := stdout
+	defer func() { stdout = out }()
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"count", root}, fmt.Sprintf("%s: 3 files 6 bytes (6 B) (2 B/file)\n", root)},
+		{[]string{"count", "--bytes", root}, fmt.Sprintf("%s: 3 files 6 bytes (2 bytes/file)\n", root)},
+		{[]string{"count", "--ext", "txt", "--json", root}, fmt.Sprintf("[{\"path\":%q,\"files\":2,\"bytes\":5,\"mean\":2.5}]\n", root)},
+		{[]string{"count", "--format", "{{.Files}} {{.Bytes}}", root}, "3 6\n"},
+		{[]string{"count", "--quiet", "--total", root, filepath.Join(root, "sub")}, "TOTAL: 5 files 10 bytes (10 B) (2 B/file)\n"},
+	}
+
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		stdout = &buf
+
+		if err := newApp().Run(append([]string{"urfs"}, tc.args...)); err != nil {
+			t.Fatalf("%v: %s", tc.args, err)
+		}
+
+		if buf.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.args, tc.expected, buf.String())
+		}
+	}
+}
+
+func TestListOutput(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aa", "sub/b.txt": "bbb", "sub/c.log": "c"})
+	defer os.RemoveAll(root)
+
+	out := stdout
+	defer func() { stdout = out }()
+
+	a, b, c := filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "b.txt"), filepath.Join(root, "sub", "c.log")
+	tests := []struct {
+		args     []string
+		sep      string
+		expected []string
+	}{
+		{[]string{"list", root}, "\n", []string{a, b, c}},
+		{[]string{"list", "--null", root}, "\x00", []string{a, b, c}},
+		{[]string{"list", "--ext", "txt", root}, "\n", []string{a, b}},
+		{[]string{"list", "--ext", "txt", "--invert", root}, "\n", []string{c}},
+		{[]string{"--match", "*.log", "list", root}, "\n", []string{c}},
+	}
+
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		stdout = &buf
+
+		if err := newApp().Run(append([]string{"urfs"}, tc.args...)); err != nil {
+			t.Fatalf("%v: %s", tc.args, err)
+		}
+
+		// The paths are printed in the order they are walked
+		output := buf.String()
+		if !strings.HasSuffix(output, tc.sep) {
+			t.Errorf("%v: expected each path to end with %q, got %q", tc.args, tc.sep, output)
+			continue
+		}
+
+		paths := strings.Split(strings.TrimSuffix(output, tc.sep), tc.sep)
+		sort.Strings(paths)
+		if !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("%v: expected %v, got %v", tc.args, tc.expected, paths)
+		}
+	}
+}
+
+func TestLogOutput(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aa", "sub/b.txt": "bbb", "sub/c.log": "c"})
+	defer os.RemoveAll(root)
+
+	out := stdout
+	defer func() { stdout, logger, logFile, cli.ErrWriter = out, nil, nil, os.Stderr }()
+
+	path := filepath.Join(root, "urfs.log")
+	missing := filepath.Join(root, "missing")
+	count := fmt.Sprintf("%s: 2 files 4 bytes (2 bytes/file)", filepath.Join(root, "sub"))
+
+	// Results are printed and appended to the log with a timestamp
+	var buf bytes.Buffer
+	stdout = &buf
+
+	args := []string{"urfs", "--log", path, "count", "--bytes", filepath.Join(root, "sub")}
+	if err := newApp().Run(args); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if buf.String() != count+"\n" {
+		t.Errorf("expected %q, got %q", count+"\n", buf.String())
+	}
+
+	// Errors are appended to the log as well, keeping the exit error from
+	// exiting the test
+	exiter := cli.OsExiter
+	defer func() { cli.OsExiter = exiter }()
+	cli.OsExiter = func(int) {}
+
+	stdout, cli.ErrWriter = ioutil.Discard, ioutil.Discard
+	args = []string{"urfs", "--log", path, "count", missing}
+	if err := newApp().Run(args); err == nil {
+		t.Fatal("expected an error counting a missing directory")
+	}
+
+	// The output of other commands is not logged
+	buf.Reset()
+	stdout = &buf
+
+	args = []string{"urfs", "--log", path, "list", filepath.Join(root, "sub")}
+	if err := newApp().Run(args); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if buf.Len() == 0 {
+		t.Error("expected list to print the paths")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines appended to the log, got %q", data)
+	}
+
+	stamp := regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+	for _, line := range lines {
+		if !stamp.MatchString(line) {
+			t.Errorf("expected a timestamp on log line %q", line)
+		}
+	}
+
+	if !strings.HasSuffix(lines[0], " "+count) {
+		t.Errorf("expected the count in the log, got %q", lines[0])
+	}
+
+	if !strings.Contains(lines[1], " error: ") || !strings.Contains(lines[1], missing) {
+		t.Errorf("expected the error in the log, got %q", lines[1])
+	}
+}
+
+func TestListJSONL(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aa", "sub/b.txt": "bbb"})
+	defer os.RemoveAll(root)
+
+	out := stdout
+	defer func() { stdout = out }()
+
+	var buf bytes.Buffer
+	stdout = &buf
+
+	args := []string{"urfs", "--file-timeout", "1s", "list", "--jsonl", root}
+	if err := newApp().Run(args); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sizes := make(map[string]int64)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		entry := new(urfs.FileEntry)
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			t.Fatalf("could not parse %q: %s", line, err)
+		}
+		sizes[entry.Path] = entry.Size
+	}
+
+	expected := map[string]int64{filepath.Join(root, "a.txt"): 2, filepath.Join(root, "sub", "b.txt"): 3}
+	if !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected %v, got %v", expected, sizes)
+	}
+}
@@ -1,67 +1,363 @@
 package urfs
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"text/template"
+
+	"golang.org/x/net/context"
 )
 
 // Count the number of files and the number of bytes in each of the specified
 // paths. Returns a struct with the count and size that can compute the mean
-// and human readable representation of the result.
+// and human readable representation of the result. If print is set, each
+// size is also written to Output as soon as it is counted. If the walk is
+// canceled, the sizes counted so far, including the partial size of the path
+// that was being counted, are returned along with context.Canceled.
 func (fs *FSWalker) Count(print bool, paths ...string) ([]*DirSize, error) {
 	sizes := make([]*DirSize, 0, len(paths))
 	for _, path := range paths {
 		size := &DirSize{Path: path}
-		if err := fs.Walk(path, size.Update); err != nil {
+		err := fs.Walk(path, fs.sizeFunc(size))
+		if err != nil && err != context.Canceled {
 			return nil, err
 		}
 		sizes = append(sizes, size)
 
 		if print {
-			fmt.Println(size.String())
+			fmt.Fprintln(fs.output(), size.String())
 		}
 
-		fs.Reset(nil)
+		if err != nil {
+			return sizes, err
+		}
 	}
 	return sizes, nil
 }
 
+// CountFiles counts the number of files and bytes of the specified file
+// paths, aggregating them into a single size whose path is TotalPath. The
+// paths are not walked or filtered, but are processed concurrently by the
+// workers as they are in a walk. If ContinueOnError is set, paths that do
+// not exist are not counted and are returned as WalkErrors along with the
+// size of the remaining files; otherwise the first error aborts the count.
+func (fs *FSWalker) CountFiles(paths []string) (*DirSize, error) {
+	size := &DirSize{Path: TotalPath}
+	err := fs.run(fs.list(paths), fs.sizeFunc(size))
+	if _, ok := err.(WalkErrors); err != nil && !ok {
+		return nil, err
+	}
+	return size, err
+}
+
+// CountParallel counts the number of files and bytes in each of the paths
+// as Count does, but walks all of the paths concurrently with a single pool
+// of workers, which is much faster when counting many small directories.
+// The sizes are printed once all of the paths have been counted. The paths
+// should not be nested inside of each other, otherwise the files of the
+// nested path will be walked and counted twice. If the walk is canceled, the
+// partial sizes are returned along with context.Canceled.
+func (fs *FSWalker) CountParallel(print bool, paths ...string) ([]*DirSize, error) {
+	sizes := make([]*DirSize, 0, len(paths))
+	for _, path := range paths {
+		sizes = append(sizes, &DirSize{Path: path})
+	}
+
+	// Attribute each file to the size of the root it was discovered under
+	err := fs.WalkMulti(paths, func(path string) (string, error) {
+		idx := rootIndex(paths, path)
+		if idx < 0 {
+			return "", fmt.Errorf("could not determine root of %s", path)
+		}
+		return fs.updateSize(sizes[idx], path)
+	})
+
+	if err != nil && err != context.Canceled {
+		return nil, err
+	}
+
+	if print {
+		for _, size := range sizes {
+			fmt.Fprintln(fs.output(), size.String())
+		}
+	}
+	return sizes, err
+}
+
+// Internal helper function that returns the index of the root that contains
+// the path, preferring the longest root if the roots are nested, or -1 if
+// none of the roots contain the path.
+func rootIndex(roots []string, path string) int {
+	idx := -1
+	for i, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if idx < 0 || len(root) > len(roots[idx]) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// Internal helper function that returns a WalkFunc updating the size with
+// respect to the walker's IncludeEmpty, DedupHardlinks, and DiskUsage
+// settings.
+func (fs *FSWalker) sizeFunc(size *DirSize) WalkFunc {
+	return func(path string) (string, error) {
+		return fs.updateSize(size, path)
+	}
+}
+
+// Internal helper function that updates the size from the file info of the
+// path on the walker's file system. If IntoArchives is set, the files in an
+// archive are counted rather than the archive itself.
+func (fs *FSWalker) updateSize(size *DirSize, path string) (string, error) {
+	info, err := fs.stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if fs.IntoArchives && info.Mode().IsRegular() && isArchive(path) {
+		return fs.updateArchive(size, path)
+	}
+	return size.update(path, info, fs.IncludeEmpty, fs.DedupHardlinks, fs.DiskUsage)
+}
+
+// Internal helper function that updates the size with the uncompressed
+// sizes of the files in the archive at path, skipping zero-byte files
+// unless IncludeEmpty is set.
+func (fs *FSWalker) updateArchive(size *DirSize, path string) (string, error) {
+	sizes, err := fs.archiveSizes(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range sizes {
+		if n <= 0 && !fs.IncludeEmpty {
+			continue
+		}
+
+		atomic.AddUint64(&size.Files, 1)
+		atomic.AddUint64(&size.Bytes, uint64(n))
+	}
+	return path, nil
+}
+
+// NoExtension is the key used by CountByExt for files without an extension.
+const NoExtension = "(none)"
+
+// CountByExt counts the number of files and bytes for each file extension in
+// the specified paths. Returns a map of the extension (including the leading
+// dot, or NoExtension) to the size of the files with that extension.
+func (fs *FSWalker) CountByExt(paths ...string) (map[string]*DirSize, error) {
+	var mu sync.Mutex
+	sizes := make(map[string]*DirSize)
+
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			ext := filepath.Ext(path)
+			if ext == "" {
+				ext = NoExtension
+			}
+
+			// Get or create the size for the extension
+			mu.Lock()
+			size, ok := sizes[ext]
+			if !ok {
+				size = &DirSize{Path: ext}
+				sizes[ext] = size
+			}
+			mu.Unlock()
+
+			return fs.updateSize(size, path)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sizes, nil
+}
+
+// TotalPath is the path of the DirSize returned by SumDirSizes.
+const TotalPath = "TOTAL"
+
+// SumDirSizes aggregates the files and bytes of the sizes into a single size
+// whose path is TotalPath.
+func SumDirSizes(sizes []*DirSize) *DirSize {
+	total := &DirSize{Path: TotalPath}
+	for _, size := range sizes {
+		total.Files += atomic.LoadUint64(&size.Files)
+		total.Bytes += atomic.LoadUint64(&size.Bytes)
+	}
+	return total
+}
+
+// SortDirSizes sorts the sizes in place by the specified key: "bytes" or
+// "files" sorts the largest sizes first and "name" sorts the paths
+// alphabetically. If reverse is set the order is reversed. Sizes that are
+// equal on the key keep their original order. An unknown key returns an
+// error without modifying the sizes.
+func SortDirSizes(sizes []*DirSize, key string, reverse bool) error {
+	var less func(a, b *DirSize) bool
+	switch key {
+	case "bytes":
+		less = func(a, b *DirSize) bool { return a.Bytes > b.Bytes }
+	case "files":
+		less = func(a, b *DirSize) bool { return a.Files > b.Files }
+	case "name":
+		less = func(a, b *DirSize) bool { return a.Path < b.Path }
+	default:
+		return fmt.Errorf("unknown sort key %q, must be bytes, files, or name", key)
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		if reverse {
+			return less(sizes[j], sizes[i])
+		}
+		return less(sizes[i], sizes[j])
+	})
+	return nil
+}
+
 // DirSize holds the number of files and bytes in a given directory.
 type DirSize struct {
-	Path  string // path to the directory
-	Files uint64 // number of files in the directory
-	Bytes uint64 // number of bytes in the directory
+	Path  string `json:"path"`  // path to the directory
+	Files uint64 `json:"files"` // number of files in the directory
+	Bytes uint64 `json:"bytes"` // number of bytes in the directory
+
+	links   map[fileID]bool // hard linked files that have been counted
+	linksMu sync.Mutex      // synchronizes access to the hard linked files
 }
 
 // Update the directory info from the given path, synchronizing as necessary.
+// Zero-byte files are counted, incrementing the number of files but not the
+// number of bytes.
 func (s *DirSize) Update(path string) (string, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return "", err
 	}
+	return s.update(path, info, true, false, false)
+}
 
+// Internal helper function that updates the directory info from the file
+// info of the path, skipping zero-byte files unless includeEmpty is true,
+// and skipping files that are hard links to a file that has already been
+// counted if dedupLinks is true. If diskUsage is true, the bytes allocated
+// to the file on disk are counted rather than its apparent size. Skipped
+// files are not returned as results of the walk.
+func (s *DirSize) update(path string, info os.FileInfo, includeEmpty, dedupLinks, diskUsage bool) (string, error) {
 	if info.IsDir() {
 		return "", nil
 	}
 
 	size := info.Size()
-	if size <= 0 {
+	if size <= 0 && !includeEmpty {
 		return "", nil
 	}
 
+	if dedupLinks && s.linked(info) {
+		return "", nil
+	}
+
+	if diskUsage {
+		size = diskSize(info)
+	}
+
 	atomic.AddUint64(&s.Files, 1)
 	atomic.AddUint64(&s.Bytes, uint64(size))
 	return path, nil
 }
 
-// Mean returns the average number of bytes per file
+// Internal helper function that returns true if the file is a hard link to
+// a file that has already been counted, recording the file if not.
+func (s *DirSize) linked(info os.FileInfo) bool {
+	id, ok := getLinkID(info)
+	if !ok {
+		return false
+	}
+
+	s.linksMu.Lock()
+	defer s.linksMu.Unlock()
+
+	if s.links == nil {
+		s.links = make(map[fileID]bool)
+	}
+
+	if s.links[id] {
+		return true
+	}
+	s.links[id] = true
+	return false
+}
+
+// Mean returns the average number of bytes per file, or zero if there are
+// no files in the directory.
 func (s *DirSize) Mean() float64 {
+	if s.Files == 0 {
+		return 0
+	}
 	return float64(s.Bytes) / float64(s.Files)
 }
 
-// String returns a string representation of the size
+// MarshalJSON includes the computed mean number of bytes per file in the
+// JSON representation of the size.
+func (s *DirSize) MarshalJSON() ([]byte, error) {
+	type dirSize DirSize
+	return json.Marshal(&struct {
+		*dirSize
+		Mean float64 `json:"mean"`
+	}{(*dirSize)(s), s.Mean()})
+}
+
+// String returns a string representation of the size with both the raw and
+// human readable number of bytes.
 func (s *DirSize) String() string {
+	return fmt.Sprintf(
+		"%s: %d files %d bytes (%s) (%s/file)",
+		s.Path, s.Files, s.Bytes, HumanizeBytes(s.Bytes), HumanizeBytes(uint64(s.Mean())),
+	)
+}
+
+// ParseSizeFormat parses a text/template format that is executed with a
+// DirSize, e.g. "{{.Path}} {{.Files}} {{.Bytes}} {{.Mean}}". The template is
+// executed with an empty size to ensure that it only references fields and
+// methods of the DirSize, so that a bad format is reported before walking.
+func ParseSizeFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("size").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse format: %s", err)
+	}
+
+	if err = tmpl.Execute(ioutil.Discard, &DirSize{}); err != nil {
+		return nil, fmt.Errorf("could not execute format: %s", err)
+	}
+	return tmpl, nil
+}
+
+// Format returns the size formatted by a template from ParseSizeFormat.
+func (s *DirSize) Format(tmpl *template.Template) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, s); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RawString returns a string representation of the size in raw bytes only.
+func (s *DirSize) RawString() string {
 	return fmt.Sprintf(
 		"%s: %d files %d bytes (%0.0f bytes/file)",
 		s.Path, s.Files, s.Bytes, s.Mean(),
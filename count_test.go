@@ -0,0 +1,408 @@
+package urfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirSizeJSON(t *testing.T) {
+	sizes := []*DirSize{
+		{Path: "full", Files: 4, Bytes: 10},
+		{Path: "empty"},
+	}
+
+	data, err := json.Marshal(sizes)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := `[{"path":"full","files":4,"bytes":10,"mean":2.5},{"path":"empty","files":0,"bytes":0,"mean":0}]`
+	if string(data) != expected {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", data, expected)
+	}
+}
+
+func TestDirSizeEmptyMean(t *testing.T) {
+	size := &DirSize{Path: "empty"}
+	if mean := size.Mean(); mean != 0 {
+		t.Errorf("expected zero mean for empty directory, got %f", mean)
+	}
+
+	if str := size.String(); strings.Contains(str, "NaN") {
+		t.Errorf("string representation contains NaN: %q", str)
+	}
+
+	if str := size.RawString(); strings.Contains(str, "NaN") {
+		t.Errorf("raw string representation contains NaN: %q", str)
+	}
+}
+
+func TestDirSizeFormat(t *testing.T) {
+	tmpl, err := ParseSizeFormat("{{.Path}},{{.Files}},{{.Bytes}},{{.Mean}}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	size := &DirSize{Path: "full", Files: 4, Bytes: 10}
+	out, err := size.Format(tmpl)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := "full,4,10,2.5"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	// Bad templates and unknown fields are reported before formatting
+	for _, format := range []string{"{{.Path", "{{.Missing}}"} {
+		if _, err := ParseSizeFormat(format); err == nil {
+			t.Errorf("expected an error parsing %q", format)
+		}
+	}
+}
+
+func TestCountByExt(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b.txt":     "world!",
+		"c.jpg":     "image",
+		"sub/d.txt": "foo",
+		"README":    "readme",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	exts, err := fs.CountByExt(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := map[string][2]uint64{
+		".txt":      {3, 14},
+		".jpg":      {1, 5},
+		NoExtension: {1, 6},
+	}
+
+	if len(exts) != len(expected) {
+		t.Fatalf("expected %d extensions, got %d", len(expected), len(exts))
+	}
+
+	for ext, counts := range expected {
+		size, ok := exts[ext]
+		if !ok {
+			t.Errorf("missing extension %q", ext)
+			continue
+		}
+
+		if size.Files != counts[0] || size.Bytes != counts[1] {
+			t.Errorf("extension %q: expected %d files %d bytes, got %d files %d bytes", ext, counts[0], counts[1], size.Files, size.Bytes)
+		}
+	}
+}
+
+func TestSumDirSizes(t *testing.T) {
+	sizes := []*DirSize{
+		{Path: "a", Files: 4, Bytes: 10},
+		{Path: "b", Files: 0, Bytes: 0},
+		{Path: "c", Files: 6, Bytes: 90},
+	}
+
+	total := SumDirSizes(sizes)
+	if total.Path != TotalPath || total.Files != 10 || total.Bytes != 100 {
+		t.Errorf("unexpected total: %+v", total)
+	}
+
+	if !strings.HasPrefix(total.String(), "TOTAL: ") {
+		t.Errorf("expected total to be clearly labeled: %q", total.String())
+	}
+
+	if empty := SumDirSizes(nil); empty.Files != 0 || empty.Bytes != 0 {
+		t.Errorf("expected empty total, got %+v", empty)
+	}
+}
+
+func TestCountEmptyFiles(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"empty.txt": "",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 2 || sizes[0].Bytes != 5 {
+		t.Errorf("expected zero-byte file to be counted, got %d files %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	if fs.NumResults() != 2 {
+		t.Errorf("expected 2 results, got %d", fs.NumResults())
+	}
+
+	// zero-byte files are skipped if not included
+	fs.IncludeEmpty = false
+	sizes, err = fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 1 || sizes[0].Bytes != 5 {
+		t.Errorf("expected zero-byte file to be skipped, got %d files %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	if fs.NumResults() != 1 {
+		t.Errorf("expected 1 result, got %d", fs.NumResults())
+	}
+}
+
+func TestCountParallel(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a/1.txt":       "one",
+		"a/2.txt":       "two",
+		"b/3.txt":       "three",
+		"b/sub/4.txt":   "four",
+		"c/5.txt":       "five",
+		"ab/6.txt":      "six",
+		"ab/sub/7.txt":  "seven",
+		"ab/sub/8.txt":  "eight",
+		"other/9.txt":   "nine",
+		"other/10.txt":  "ten",
+		"other/11.txt":  "eleven",
+		"other/12.txt":  "twelve",
+		"other/13.txt":  "thirteen",
+		"other/14.txt":  "fourteen",
+		"other/15.txt":  "fifteen",
+		"other/x/y.txt": "y",
+	})
+	defer os.RemoveAll(root)
+
+	paths := make([]string, 0)
+	for _, dir := range []string{"a", "b", "c", "ab", "other"} {
+		paths = append(paths, filepath.Join(root, dir))
+	}
+
+	fs := makeWalker()
+	expected, err := fs.Count(false, paths...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sizes, err := fs.CountParallel(false, paths...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(sizes) != len(expected) {
+		t.Fatalf("expected %d sizes, got %d", len(expected), len(sizes))
+	}
+
+	for i, size := range sizes {
+		if size.Path != expected[i].Path || size.Files != expected[i].Files || size.Bytes != expected[i].Bytes {
+			t.Errorf("expected %s, got %s", expected[i].RawString(), size.RawString())
+		}
+	}
+
+	if fs.NumPaths() != 16 {
+		t.Errorf("expected 16 paths discovered in a single walk, got %d", fs.NumPaths())
+	}
+}
+
+func TestRootIndex(t *testing.T) {
+	roots := []string{"src", "src/nested", ".", "/abs/path"}
+	tests := map[string]int{
+		"src/a.txt":          0,
+		"src/nested/b.txt":   1,
+		"c.txt":              2,
+		"srcfile.txt":        2,
+		"/abs/path/d.txt":    3,
+		"/abs/pathology.txt": -1,
+	}
+
+	for path, expected := range tests {
+		if idx := rootIndex(roots, filepath.FromSlash(path)); idx != expected {
+			t.Errorf("expected root %d for %s, got %d", expected, path, idx)
+		}
+	}
+}
+
+func TestCountFiles(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b.txt":     "world!",
+		"sub/c.txt": "foo",
+		"d.txt":     "not counted",
+	})
+	defer os.RemoveAll(root)
+
+	paths := []string{
+		filepath.Join(root, "a.txt"),
+		filepath.Join(root, "b.txt"),
+		filepath.Join(root, "sub", "c.txt"),
+	}
+
+	fs := makeWalker()
+	size, err := fs.CountFiles(paths)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if size.Path != TotalPath || size.Files != 3 || size.Bytes != 14 {
+		t.Errorf("unexpected size: %s", size.RawString())
+	}
+
+	// nonexistent paths abort the count
+	paths = append(paths, filepath.Join(root, "missing.txt"))
+	if _, err := fs.CountFiles(paths); err == nil {
+		t.Error("expected error for nonexistent path")
+	}
+
+	// unless continuing on error
+	fs.ContinueOnError = true
+	size, err = fs.CountFiles(paths)
+	if errs, ok := err.(WalkErrors); !ok || len(errs) != 1 {
+		t.Errorf("expected one collected error, got %v", err)
+	}
+
+	if size == nil || size.Files != 3 || size.Bytes != 14 {
+		t.Errorf("expected existing files to be counted, got %v", size)
+	}
+}
+
+func TestSortDirSizes(t *testing.T) {
+	tests := []struct {
+		key      string
+		reverse  bool
+		expected string
+	}{
+		{"bytes", false, "c,a,d,b"},
+		{"bytes", true, "b,a,d,c"},
+		{"files", false, "a,d,c,b"},
+		{"files", true, "b,c,a,d"},
+		{"name", false, "a,b,c,d"},
+		{"name", true, "d,c,b,a"},
+	}
+
+	for _, tt := range tests {
+		// a and d are tied on bytes and files so they keep the input order
+		sizes := []*DirSize{
+			{Path: "c", Files: 2, Bytes: 90},
+			{Path: "a", Files: 4, Bytes: 10},
+			{Path: "d", Files: 4, Bytes: 10},
+			{Path: "b", Files: 0, Bytes: 0},
+		}
+
+		if err := SortDirSizes(sizes, tt.key, tt.reverse); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		paths := make([]string, 0, len(sizes))
+		for _, size := range sizes {
+			paths = append(paths, size.Path)
+		}
+
+		if order := strings.Join(paths, ","); order != tt.expected {
+			t.Errorf("sort by %s (reverse %t): expected %s, got %s", tt.key, tt.reverse, tt.expected, order)
+		}
+	}
+
+	if err := SortDirSizes(nil, "mean", false); err == nil {
+		t.Error("expected error for unknown sort key")
+	}
+}
+
+func TestCountSingleFile(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt": "hello",
+	})
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "a.txt")
+	fs := makeWalker()
+	sizes, err := fs.Count(false, path, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, size := range sizes {
+		if size.Files != 1 || size.Bytes != 5 {
+			t.Errorf("expected 1 file and 5 bytes for %s, got %+v", size.Path, size)
+		}
+	}
+
+	// the single file is counted without starting any workers
+	fs = makeWalker()
+	if _, err := fs.Count(false, path); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.nWorkers != 0 || fs.NumPaths() != 1 || fs.NumResults() != 1 {
+		t.Errorf("expected 1 path and result with no workers, got %d paths %d results %d workers", fs.NumPaths(), fs.NumResults(), fs.nWorkers)
+	}
+
+	// filters still apply to the single file
+	fs = makeWalker()
+	fs.Match = "*.jpg"
+	sizes, err = fs.Count(false, path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 0 {
+		t.Errorf("expected the unmatched file not to be counted, got %+v", sizes[0])
+	}
+}
+
+func TestCountEmptyDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 0 || sizes[0].Bytes != 0 || fs.nWorkers != 0 {
+		t.Errorf("expected an empty count with no workers, got %+v with %d workers", sizes[0], fs.nWorkers)
+	}
+}
+
+func TestCountOutput(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "aa",
+		"sub/b.txt": "bbb",
+	})
+	defer os.RemoveAll(root)
+
+	// The sizes are printed to Output as they are counted if required
+	var buf strings.Builder
+	fs := makeWalker()
+	fs.Output = &buf
+
+	if _, err := fs.Count(false, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output without print, got %q", buf.String())
+	}
+
+	if _, err := fs.Count(true, root, filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := root + ": 2 files 5 bytes (5 B) (2 B/file)\n" + filepath.Join(root, "sub") + ": 1 files 3 bytes (3 B) (3 B/file)\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,91 @@
+//go:build !windows
+// +build !windows
+
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountDedupHardlinks(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     strings.Repeat("a", 100),
+		"sub/b.txt": strings.Repeat("b", 10),
+	})
+	defer os.RemoveAll(root)
+
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "link.txt")); err != nil {
+		t.Skipf("could not create hard link: %s", err)
+	}
+
+	fs := makeWalker()
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 3 || sizes[0].Bytes != 210 {
+		t.Errorf("expected links to be counted separately, got %d files %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	fs.DedupHardlinks = true
+	if sizes, err = fs.Count(false, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 2 || sizes[0].Bytes != 110 {
+		t.Errorf("expected linked bytes to be counted once, got %d files %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+}
+
+func TestCountDiskUsage(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt": strings.Repeat("a", 100),
+	})
+	defer os.RemoveAll(root)
+
+	// Create a sparse file with an apparent size of 1 MiB
+	f, err := os.Create(filepath.Join(root, "sparse.dat"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = f.Truncate(1 << 20); err != nil {
+		f.Close()
+		t.Fatal(err.Error())
+	}
+	f.Close()
+
+	fs := makeWalker()
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 2 || sizes[0].Bytes != 100+1<<20 {
+		t.Errorf("expected 2 files and %d apparent bytes, got %+v", 100+1<<20, sizes[0])
+	}
+
+	fs = makeWalker()
+	fs.DiskUsage = true
+	sizes, err = fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 2 {
+		t.Errorf("expected 2 files, got %d", sizes[0].Files)
+	}
+
+	if sizes[0].Bytes >= 1<<20 {
+		t.Skipf("file system does not support sparse files: %d bytes allocated", sizes[0].Bytes)
+	}
+
+	// The allocated size is a whole number of blocks covering the small file
+	if sizes[0].Bytes < 100 || sizes[0].Bytes%512 != 0 {
+		t.Errorf("expected whole blocks allocated for the non-sparse file, got %d bytes", sizes[0].Bytes)
+	}
+}
@@ -0,0 +1,201 @@
+package urfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Duplicates finds files with identical contents in the specified paths,
+// returning groups of paths keyed by the hex SHA-256 digest of their
+// contents. Only groups with more than one member are returned. To avoid
+// hashing every file, the paths are first walked to count files by size,
+// then walked again hashing only those files whose size collides.
+//
+// If HeadBytes is set, only the first HeadBytes of each file are hashed,
+// which bounds the IO for huge files at the cost of accuracy: files of the
+// same size that share a head but differ after it are reported as
+// duplicates. Since files are only grouped with files of the same size, the
+// groups are then keyed by the digest of the head and the size of the files,
+// e.g. "<digest>:1048576", so that files with a common head but different
+// sizes are never grouped together.
+//
+// A path that is repeated or nested inside another of the paths is skipped,
+// since its files are already walked from the other path and would otherwise
+// be reported as duplicates of themselves.
+func (fs *FSWalker) Duplicates(paths ...string) (map[string][]string, error) {
+	var mu sync.Mutex
+
+	paths, err := fs.distinctRoots(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the number of files of each size
+	sizes := make(map[int64]uint64)
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			info, err := fs.stat(path)
+			if err != nil {
+				return "", err
+			}
+
+			mu.Lock()
+			sizes[info.Size()]++
+			mu.Unlock()
+			return path, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Hash the files whose size collides with another file
+	groups := make(map[string][]string)
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			info, err := fs.stat(path)
+			if err != nil {
+				return "", err
+			}
+
+			mu.Lock()
+			count := sizes[info.Size()]
+			mu.Unlock()
+
+			if count < 2 {
+				return "", nil
+			}
+
+			digest, err := fs.hashHead(path, sha256.New(), fs.HeadBytes)
+			if err != nil {
+				return "", err
+			}
+
+			if fs.HeadBytes > 0 {
+				digest = fmt.Sprintf("%s:%d", digest, info.Size())
+			}
+
+			mu.Lock()
+			groups[digest] = append(groups[digest], path)
+			mu.Unlock()
+			return path, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Remove any groups that do not have duplicates
+	for digest, group := range groups {
+		if len(group) < 2 {
+			delete(groups, digest)
+		}
+	}
+
+	return groups, nil
+}
+
+// Internal helper function that removes the paths that are the same as or
+// nested inside another of the paths, comparing the cleaned absolute paths
+// (or the cleaned paths on the walker's FS). The remaining paths are
+// returned in their original order and form.
+func (fs *FSWalker) distinctRoots(paths []string) ([]string, error) {
+	keys := make([]string, len(paths))
+	for i, path := range paths {
+		if fs.FS != nil {
+			keys[i] = filepath.ToSlash(filepath.Clean(path))
+			continue
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = abs
+	}
+
+	// A path is kept unless it is within another path, and of equal paths
+	// only the first is kept.
+	distinct := make([]string, 0, len(paths))
+	for i, key := range keys {
+		keep := true
+		for j, other := range keys {
+			if i != j && fs.within(key, other) && (key != other || j < i) {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			distinct = append(distinct, paths[i])
+		}
+	}
+	return distinct, nil
+}
+
+// Internal helper function that returns true if the cleaned path is the
+// same as or inside of the cleaned root.
+func (fs *FSWalker) within(path, root string) bool {
+	if fs.FS != nil {
+		return root == "." || path == root || strings.HasPrefix(path, root+"/")
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Internal helper function that computes the hex digest of the contents of
+// the file at path using the specified hash.
+func hashFile(path string, h hash.Hash) (string, error) {
+	return hashFileHead(path, h, 0)
+}
+
+// Internal helper function that computes the hex digest of at most the first
+// n bytes of the file at path using the specified hash, or of all of the
+// contents if n is not positive.
+func hashFileHead(path string, h hash.Hash, n int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f, h, n)
+}
+
+// Internal helper function that computes the hex digest of at most the first
+// n bytes of the file at path on the walker's file system, as hashFileHead
+// does on the real file system.
+func (fs *FSWalker) hashHead(path string, h hash.Hash, n int64) (string, error) {
+	f, err := fs.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f, h, n)
+}
+
+// Internal helper function that computes the hex digest of at most the first
+// n bytes read from r, or of all of them if n is not positive.
+func hashReader(r io.Reader, h hash.Hash, n int64) (string, error) {
+	if n > 0 {
+		r = io.LimitReader(r, n)
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,149 @@
+package urfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":       "hello world",
+		"sub/b.txt":   "hello world",
+		"sub/c.txt":   "hello there",
+		"d.txt":       "unique size",
+		"other/e.txt": "foo",
+		"other/f.txt": "foo",
+		"other/g.txt": "foo",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	groups, err := fs.Duplicates(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 duplicate groups, got %d: %v", len(groups), groups)
+	}
+
+	for _, group := range groups {
+		sort.Strings(group)
+		switch len(group) {
+		case 2:
+			if group[0] != filepath.Join(root, "a.txt") || group[1] != filepath.Join(root, "sub", "b.txt") {
+				t.Errorf("unexpected duplicate group: %v", group)
+			}
+		case 3:
+			if filepath.Dir(group[0]) != filepath.Join(root, "other") {
+				t.Errorf("unexpected duplicate group: %v", group)
+			}
+		default:
+			t.Errorf("unexpected duplicate group: %v", group)
+		}
+	}
+}
+
+func TestDuplicatesOverlapping(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello world",
+		"sub/b.txt": "hello there",
+		"sub/c.txt": "unique size",
+	})
+	defer os.RemoveAll(root)
+
+	// Files walked from repeated or nested roots are not their own duplicates
+	fs := makeWalker()
+	groups, err := fs.Duplicates(filepath.Join(root, "sub"), root, root+string(filepath.Separator))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 0 {
+		t.Errorf("expected no duplicate groups, got %v", groups)
+	}
+
+	// A root that is a prefix of another's name is not nested inside it
+	if err := os.MkdirAll(filepath.Join(root, "subdir"), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "subdir", "b.txt"), []byte("hello there"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if groups, err = fs.Duplicates(filepath.Join(root, "sub"), filepath.Join(root, "subdir")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 1 {
+		t.Errorf("expected 1 duplicate group, got %v", groups)
+	}
+}
+
+func TestDuplicatesHeadBytes(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt": "shared prefix, then a",
+		"b.txt": "shared prefix, then b",
+		"c.txt": "shared prefix, and then c",
+		"d.txt": "shared prefix, and then d",
+		"e.txt": "different prefix the end",
+	})
+	defer os.RemoveAll(root)
+
+	// Hashing the full contents finds no duplicates
+	fs := makeWalker()
+	groups, err := fs.Duplicates(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 0 {
+		t.Errorf("expected no duplicates hashing the full contents, got %v", groups)
+	}
+
+	// Hashing the heads groups files of the same size that share a prefix
+	fs.HeadBytes = 14
+	if groups, err = fs.Duplicates(root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 duplicate groups hashing the heads, got %d: %v", len(groups), groups)
+	}
+
+	for key, group := range groups {
+		sort.Strings(group)
+		if len(group) != 2 {
+			t.Errorf("unexpected duplicate group: %v", group)
+			continue
+		}
+
+		info, err := os.Stat(group[0])
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if !strings.HasSuffix(key, fmt.Sprintf(":%d", info.Size())) {
+			t.Errorf("expected the key %q to end with the size of the files", key)
+		}
+
+		switch filepath.Base(group[0]) {
+		case "a.txt":
+			if filepath.Base(group[1]) != "b.txt" {
+				t.Errorf("unexpected duplicate group: %v", group)
+			}
+		case "c.txt":
+			if filepath.Base(group[1]) != "d.txt" {
+				t.Errorf("unexpected duplicate group: %v", group)
+			}
+		default:
+			t.Errorf("unexpected duplicate group: %v", group)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sync/errgroup"
+)
+
+//===========================================================================
+// Concurrent Directory Walk
+//===========================================================================
+
+// Internal helper function that walks the directory tree rooted at root as
+// filepath.Walk does, calling walkFn with the lstat info of every file and
+// directory, but reading up to DirWorkers directories concurrently. On deep
+// or wide trees, especially on network file systems where every directory
+// read is a round trip, reading one directory at a time starves the workers
+// of paths; with several directory readers, the paths are discovered as
+// fast as the workers can process them.
+//
+// The semantics of walkFn are those of filepath.Walk: a directory is passed
+// to walkFn before it is read, returning filepath.SkipDir from a directory
+// skips it, returning filepath.SkipDir from a file skips the remaining
+// entries of its directory, and any other error stops the walk and is
+// returned. Unlike filepath.Walk, walkFn is called concurrently and the
+// entries of different directories are visited in no particular order.
+//
+// A directory is read by a new goroutine if fewer than DirWorkers
+// directories are being read, otherwise it is read by the goroutine that
+// found it, so that the walk never blocks waiting for a reader.
+func (fs *FSWalker) walkConcurrent(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil || !info.IsDir() {
+		err = walkFn(root, info, err)
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	// The goroutine that reads the root is one of the readers
+	readers := make(chan struct{}, fs.DirWorkers-1)
+	group, ctx := errgroup.WithContext(fs.ctx)
+
+	var readDir func(path string, info os.FileInfo) error
+	readDir = func(path string, info os.FileInfo) error {
+		if err := walkFn(path, info, nil); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+
+		// Report the read error as filepath.Walk does, along with the
+		// directory, and continue with the entries that were read
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			if err = walkFn(path, info, err); err != nil {
+				if err == filepath.SkipDir {
+					return nil
+				}
+				return err
+			}
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			child := filepath.Join(path, entry.Name())
+			cinfo, err := entry.Info()
+			if err != nil {
+				if err = walkFn(child, nil, err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+
+			if !cinfo.IsDir() {
+				if err := walkFn(child, cinfo, nil); err != nil {
+					if err == filepath.SkipDir {
+						return nil
+					}
+					return err
+				}
+				continue
+			}
+
+			select {
+			case readers <- struct{}{}:
+				group.Go(func() error {
+					defer func() { <-readers }()
+					return readDir(child, cinfo)
+				})
+			default:
+				if err := readDir(child, cinfo); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	group.Go(func() error {
+		return readDir(root, info)
+	})
+	return group.Wait()
+}
@@ -0,0 +1,117 @@
+package urfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWalkConcurrent(t *testing.T) {
+	files := map[string]string{
+		".hidden/a.txt":         "a",
+		"node_modules/b.txt":    "b",
+		"c.txt":                 "c",
+		"one/.d.txt":            "d",
+		"one/e.log":             "e",
+		"one/two/f.txt":         "f",
+		"one/two/three/g.txt":   "g",
+		"one/two/three/h.txt":   "h",
+		"other/i.txt":           "i",
+		"other/deep/er/j.txt":   "j",
+		"other/deep/er/k.jpg":   "k",
+		"other/deep/est/l.txt":  "l",
+		"other/deep/est/m/n.go": "n",
+	}
+
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("wide/dir%02d/file.txt", i)] = "w"
+	}
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	configs := map[string]func(fs *FSWalker){
+		"defaults":  func(fs *FSWalker) {},
+		"hidden":    func(fs *FSWalker) { fs.SkipHidden = false },
+		"skip dirs": func(fs *FSWalker) { fs.SkipDirNames = []string{"node_modules", "three"} },
+		"max depth": func(fs *FSWalker) { fs.MaxDepth = 3 },
+		"match":     func(fs *FSWalker) { fs.Match = "*.txt" },
+		"dirs":      func(fs *FSWalker) { fs.SkipDirs = false },
+	}
+
+	for name, configure := range configs {
+		// The concurrent walk must find the same paths as filepath.Walk
+		var expected []string
+		for _, workers := range []int{0, 2, 8} {
+			fs := makeWalker()
+			fs.DirWorkers = workers
+			configure(fs)
+
+			paths, err := walkRelPaths(fs, root)
+			if err != nil {
+				t.Fatalf("%s with %d dir workers: %s", name, workers, err)
+			}
+
+			if workers == 0 {
+				expected = paths
+				if len(expected) == 0 {
+					t.Fatalf("%s: expected the walk to find paths", name)
+				}
+				continue
+			}
+
+			if strings.Join(paths, ",") != strings.Join(expected, ",") {
+				t.Errorf("%s with %d dir workers: expected %v, got %v", name, workers, expected, paths)
+			}
+		}
+	}
+
+	// An error from the walk function stops the concurrent walk
+	fs := makeWalker()
+	fs.DirWorkers = 4
+	failure := errors.New("could not process file")
+	err := fs.Walk(root, func(path string) (string, error) {
+		if filepath.Base(path) == "g.txt" {
+			return "", failure
+		}
+		return path, nil
+	})
+
+	if err != failure {
+		t.Errorf("expected the walk to fail with %q, got %v", failure, err)
+	}
+
+	// A root that does not exist is an error as it is for filepath.Walk
+	fs = makeWalker()
+	fs.DirWorkers = 4
+	if err := fs.Walk(filepath.Join(root, "missing"), func(path string) (string, error) { return path, nil }); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error walking a missing root, got %v", err)
+	}
+}
+
+// Helper function that walks the root, returning the sorted slash separated
+// paths relative to the root that were processed.
+func walkRelPaths(fs *FSWalker, root string) ([]string, error) {
+	var mu sync.Mutex
+	paths := make([]string, 0)
+
+	err := fs.Walk(root, func(path string) (string, error) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		paths = append(paths, filepath.ToSlash(rel))
+		mu.Unlock()
+		return path, nil
+	})
+
+	sort.Strings(paths)
+	return paths, err
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package urfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Internal helper that returns the number of bytes allocated to the file on
+// disk from its 512-byte block count, which is less than the apparent size
+// for sparse files. Falls back to the apparent size if blocks are unknown.
+func diskSize(info os.FileInfo) int64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+	return int64(stat.Blocks) * 512
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package urfs
+
+import "os"
+
+// Internal helper that returns the number of bytes allocated to the file on
+// disk, which is not available from the file info on Windows, so the
+// apparent size is used instead.
+func diskSize(info os.FileInfo) int64 {
+	return info.Size()
+}
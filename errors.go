@@ -0,0 +1,49 @@
+package urfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// WalkErrors is a collection of errors encountered on a walk that was
+// configured to continue on error rather than aborting the operation.
+type WalkErrors []error
+
+// Error returns a summary of the errors, listing each on its own line.
+func (e WalkErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	msgs := make([]string, 0, len(e)+1)
+	msgs = append(msgs, fmt.Sprintf("%d errors occurred during walk:", len(e)))
+	for _, err := range e {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Internal type that synchronizes the collection of errors from concurrent
+// workers and the walk goroutine.
+type errorCollector struct {
+	sync.Mutex
+	errs WalkErrors
+}
+
+// Add an error to the collection.
+func (c *errorCollector) add(err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+// Err returns the collected errors or nil if no errors have been collected.
+func (c *errorCollector) err() error {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package urfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Internal helper that returns the device and inode pair that uniquely
+// identifies the file on Unix systems.
+func getFileID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+// Internal helper that returns the identity of the file only if it has more
+// than one hard link, so that only linked files need to be tracked.
+func getLinkID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
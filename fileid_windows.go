@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package urfs
+
+import "os"
+
+// Internal helper that returns the identity of the file, which is not
+// available from the file info on Windows.
+func getFileID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// Internal helper that returns the identity of a hard linked file, which is
+// not available from the file info on Windows, so links are not detected.
+func getLinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -1,10 +1,16 @@
 package urfs
 
 import (
+	"bufio"
+	"compress/gzip"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
 )
 
 //===========================================================================
@@ -30,6 +36,25 @@ func Mkdir(path string) error {
 	return nil
 }
 
+// ReadPaths reads newline separated paths from the reader, ignoring blank
+// lines and comment lines that start with "#".
+func ReadPaths(r io.Reader) ([]string, error) {
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
 //===========================================================================
 // Shutil
 //===========================================================================
@@ -38,16 +63,50 @@ func Mkdir(path string) error {
 // If dst does not exist, CopyFile creates it with permissions perm.
 // If the copy fails, CopyFile aborts and dst is preserved.
 func CopyFile(dst, src string, perm os.FileMode) error {
+	return CopyFileContext(context.Background(), dst, src, perm)
+}
+
+// CopyFileContext copies the contents from src to dst atomically as CopyFile
+// does, checking the context between each chunk that is copied. If the
+// context is canceled, the copy aborts, the partially copied temporary file
+// is removed, and dst is preserved.
+func CopyFileContext(ctx context.Context, dst, src string, perm os.FileMode) error {
+	return copyFile(ctx, dst, src, perm, nil, nil)
+}
+
+// CopyProgressFunc is called with the number of bytes copied and the total
+// number of bytes in the file being copied.
+type CopyProgressFunc func(copied, total int64)
+
+// ProgressBytes is the number of bytes copied between calls to the
+// CopyProgressFunc.
+const ProgressBytes = 1 << 20
+
+// CopyFileProgress copies the contents from src to dst atomically as
+// CopyFile does, calling progress every ProgressBytes bytes copied and once
+// more when the copy is complete, so that the progress of copying large
+// files can be reported.
+func CopyFileProgress(dst, src string, perm os.FileMode, progress CopyProgressFunc) error {
+	return copyFile(context.Background(), dst, src, perm, nil, progress)
+}
+
+// Internal helper for CopyFileContext that limits the rate of the copy if a
+// limiter is specified and reports its progress if a progress func is.
+func copyFile(ctx context.Context, dst, src string, perm os.FileMode, lim *rate.Limiter, progress CopyProgressFunc) error {
 	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
+	r, err := newContextReader(ctx, in, lim, progress)
+	if err != nil {
+		return err
+	}
 	tmp, err := ioutil.TempFile(filepath.Dir(dst), "")
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(tmp, in)
+	_, err = io.Copy(tmp, r)
 	if err != nil {
 		tmp.Close()
 		os.Remove(tmp.Name())
@@ -63,3 +122,121 @@ func CopyFile(dst, src string, perm os.FileMode) error {
 	}
 	return os.Rename(tmp.Name(), dst)
 }
+
+// CopyFileMeta copies the contents from src to dst atomically as CopyFile
+// does, preserving the permissions and the access and modification times of
+// the source file. The times are set after the file is renamed to dst.
+func CopyFileMeta(dst, src string) error {
+	return copyFileMeta(context.Background(), dst, src, nil, nil)
+}
+
+// Internal helper for CopyFileMeta that checks the context during the copy,
+// limits its rate if a limiter is specified, and reports its progress if a
+// progress func is specified.
+func copyFileMeta(ctx context.Context, dst, src string, lim *rate.Limiter, progress CopyProgressFunc) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if err = copyFile(ctx, dst, src, info.Mode().Perm(), lim, progress); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, atime(info), info.ModTime())
+}
+
+// CopyFileGzip copies the contents from src to dst atomically as CopyFile
+// does, compressing the contents with gzip as they are written.
+func CopyFileGzip(dst, src string, perm os.FileMode) error {
+	return copyFileGzip(context.Background(), dst, src, perm, nil, nil)
+}
+
+// Internal helper for CopyFileGzip that checks the context during the copy,
+// limits its rate if a limiter is specified, and reports its progress if a
+// progress func is specified.
+func copyFileGzip(ctx context.Context, dst, src string, perm os.FileMode, lim *rate.Limiter, progress CopyProgressFunc) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := newContextReader(ctx, in, lim, progress)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(tmp)
+	gz.Name = filepath.Base(src)
+	_, err = io.Copy(gz, r)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Internal reader that returns the context error once the context is done,
+// allowing long copies to be interrupted between reads. If a limiter is
+// specified, each read waits until the bytes read are allowed by the rate.
+// If a progress func is specified, it is called every ProgressBytes bytes
+// read and once more when the end of the file is reached.
+type contextReader struct {
+	ctx      context.Context
+	r        io.Reader
+	lim      *rate.Limiter
+	progress CopyProgressFunc
+	total    int64 // size of the file being read
+	read     int64 // number of bytes read so far
+	reported int64 // number of bytes read when progress was last reported
+}
+
+// Internal helper function that creates a reader for the file, getting its
+// size if the progress is reported.
+func newContextReader(ctx context.Context, f *os.File, lim *rate.Limiter, progress CopyProgressFunc) (*contextReader, error) {
+	r := &contextReader{ctx: ctx, r: f, lim: lim, progress: progress}
+	if progress != nil {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		r.total = info.Size()
+	}
+	return r, nil
+}
+
+// Read from the underlying reader if the context is not done.
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.r.Read(p)
+	if werr := waitBytes(r.ctx, r.lim, n); werr != nil {
+		return n, werr
+	}
+
+	if r.progress != nil {
+		r.read += int64(n)
+		if r.read-r.reported >= ProgressBytes || (err == io.EOF && r.read > r.reported) {
+			r.reported = r.read
+			r.progress(r.read, r.total)
+		}
+	}
+	return n, err
+}
@@ -1,10 +1,15 @@
 package urfs
 
 import (
+	"compress/gzip"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 func TestPathExists(t *testing.T) {
@@ -120,3 +125,211 @@ func TestMkdirAll(t *testing.T) {
 		t.Fatalf("%s not correctly created", path)
 	}
 }
+
+// TestCopyFileMeta ensures the mode and modification time are preserved.
+func TestCopyFileMeta(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	// create a source file with a specific mode and modification time
+	src := filepath.Join(tmpdir, "src.txt")
+	if err := ioutil.WriteFile(src, []byte("hello world"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	mtime := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// copy the file and check its metadata
+	dst := filepath.Join(tmpdir, "dst.txt")
+	if err := CopyFileMeta(dst, src); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %s", info.Mode().Perm())
+	}
+
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected modification time %s, got %s", mtime, info.ModTime())
+	}
+
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != "hello world" {
+		t.Errorf("unexpected copied contents %q", data)
+	}
+}
+
+// TestReadPaths ensures blank and comment lines are ignored.
+func TestReadPaths(t *testing.T) {
+	input := "/path/to/a\n\n# a comment\n  /path/to/b  \n\t\n/path/to/c"
+	paths, err := ReadPaths(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []string{"/path/to/a", "/path/to/b", "/path/to/c"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+// TestCopyFileContext ensures a canceled copy cleans up after itself.
+func TestCopyFileContext(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src.txt")
+	if err := ioutil.WriteFile(src, []byte(strings.Repeat("a", 1<<20)), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a copy with an active context should succeed
+	dst := filepath.Join(tmpdir, "dst.txt")
+	if err := CopyFileContext(context.Background(), dst, src, 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a copy with a canceled context should fail and leave nothing behind
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	canceled := filepath.Join(tmpdir, "canceled.txt")
+	if err := CopyFileContext(ctx, canceled, src, 0644); err != context.Canceled {
+		t.Fatalf("expected context canceled error, got %v", err)
+	}
+
+	files, err := ioutil.ReadDir(tmpdir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(files) != 2 {
+		t.Errorf("expected only the src and dst files, found %d files", len(files))
+	}
+}
+
+// TestCopyFileProgress ensures the progress increases monotonically and is
+// reported once the whole file has been copied.
+func TestCopyFileProgress(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	size := int64(5*ProgressBytes + 1234)
+	src := filepath.Join(tmpdir, "src.txt")
+	if err := ioutil.WriteFile(src, []byte(strings.Repeat("a", int(size))), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var calls []int64
+	dst := filepath.Join(tmpdir, "dst.txt")
+	err = CopyFileProgress(dst, src, 0644, func(copied, total int64) {
+		if total != size {
+			t.Errorf("expected total of %d bytes, got %d", size, total)
+		}
+		calls = append(calls, copied)
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(calls) < 5 {
+		t.Fatalf("expected at least 5 progress calls, got %d", len(calls))
+	}
+
+	for i := 1; i < len(calls); i++ {
+		if calls[i] <= calls[i-1] {
+			t.Errorf("progress did not increase: %d after %d", calls[i], calls[i-1])
+		}
+	}
+
+	if last := calls[len(calls)-1]; last != size {
+		t.Errorf("expected final progress of %d bytes, got %d", size, last)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Size() != size {
+		t.Errorf("expected dst of %d bytes, got %d", size, info.Size())
+	}
+}
+
+// TestCopyFileGzip ensures the compressed copy decompresses to the source.
+func TestCopyFileGzip(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	contents := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+	src := filepath.Join(tmpdir, "src.txt")
+	if err := ioutil.WriteFile(src, []byte(contents), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	dst := filepath.Join(tmpdir, "src.txt.gz")
+	if err := CopyFileGzip(dst, src, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %s", info.Mode().Perm())
+	}
+
+	if info.Size() >= int64(len(contents)) {
+		t.Errorf("expected compressed file to be smaller than %d bytes, got %d", len(contents), info.Size())
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != contents {
+		t.Error("decompressed contents do not match the source")
+	}
+}
@@ -0,0 +1,97 @@
+package urfs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+)
+
+//===========================================================================
+// File System Access
+//===========================================================================
+
+// The walker reads the real file system unless the FS field is set, in which
+// case the walk, the filters, MIME detection, counting, size statistics,
+// ranking, and duplicate detection use the FS instead, e.g. an fstest.MapFS
+// in tests. Paths on an FS are slash separated and unrooted as required by
+// io/fs, with "." as the root of the FS.
+
+// Internal helper function that returns the file info of the path, following
+// symbolic links on the real file system.
+func (fs *FSWalker) stat(path string) (os.FileInfo, error) {
+	if fs.FS != nil {
+		return iofs.Stat(fs.FS, path)
+	}
+	return os.Stat(path)
+}
+
+// Internal helper function that returns the file info of the path without
+// following symbolic links on the real file system.
+func (fs *FSWalker) lstat(path string) (os.FileInfo, error) {
+	if fs.FS != nil {
+		return iofs.Stat(fs.FS, path)
+	}
+	return os.Lstat(path)
+}
+
+// Internal helper function that opens the file at path for reading.
+func (fs *FSWalker) open(path string) (io.ReadCloser, error) {
+	if fs.FS != nil {
+		return fs.FS.Open(path)
+	}
+	return os.Open(path)
+}
+
+// Internal helper function that returns true if the directory at path has
+// no entries, reading at most one entry to find out.
+func (fs *FSWalker) emptyDir(path string) bool {
+	if fs.FS != nil {
+		f, err := fs.FS.Open(path)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		dir, ok := f.(iofs.ReadDirFile)
+		if !ok {
+			return false
+		}
+
+		entries, _ := dir.ReadDir(1)
+		return len(entries) == 0
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+
+	names, _ := dir.Readdirnames(1)
+	return len(names) == 0
+}
+
+// Internal helper function that walks the root with filepath.Walk, or with
+// fs.WalkDir if an FS is specified, passing the file info of every entry to
+// the walk function as filepath.Walk does. If DirWorkers is greater than one,
+// the real file system is walked by reading directories concurrently.
+func (fs *FSWalker) walkRoot(root string, walkFn filepath.WalkFunc) error {
+	if fs.FS == nil {
+		if fs.DirWorkers > 1 {
+			return fs.walkConcurrent(root, walkFn)
+		}
+		return filepath.Walk(root, walkFn)
+	}
+
+	return iofs.WalkDir(fs.FS, root, func(path string, d iofs.DirEntry, err error) error {
+		var info os.FileInfo
+		if d != nil {
+			var ierr error
+			if info, ierr = d.Info(); ierr != nil && err == nil {
+				err = ierr
+			}
+		}
+		return walkFn(path, info, err)
+	})
+}
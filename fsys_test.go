@@ -0,0 +1,191 @@
+package urfs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// Helper function that creates an in-memory file system for the walker.
+func makeMapFS() fstest.MapFS {
+	return fstest.MapFS{
+		"a.txt":              {Data: []byte("aaaa")},
+		"b.csv":              {Data: []byte("bb")},
+		"empty.txt":          {},
+		"docs/c.txt":         {Data: []byte("cccccc")},
+		"docs/d.md":          {Data: []byte("d")},
+		"docs/.hidden.txt":   {Data: []byte("hidden")},
+		".git/config":        {Data: []byte("config")},
+		"node_modules/e.txt": {Data: []byte("e")},
+	}
+}
+
+func TestCountFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = makeMapFS()
+	fs.IncludeEmpty = true
+	fs.SkipHidden = true
+
+	sizes, err := fs.Count(false, ".", "docs")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []struct {
+		files, bytes uint64
+	}{{6, 14}, {2, 7}}
+
+	for i, size := range sizes {
+		if size.Files != expected[i].files || size.Bytes != expected[i].bytes {
+			t.Errorf(
+				"expected %s to have %d files and %d bytes, got %d files and %d bytes",
+				size.Path, expected[i].files, expected[i].bytes, size.Files, size.Bytes,
+			)
+		}
+	}
+
+	// A single file on the FS is counted without the workers
+	sizes, err = fs.Count(false, "docs/c.txt")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 1 || sizes[0].Bytes != 6 {
+		t.Errorf("expected 1 file and 6 bytes, got %d files and %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+}
+
+func TestMatchFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = makeMapFS()
+	fs.SkipHidden = true
+	fs.SkipDirNames = []string{"node_modules"}
+
+	fs.Match = "*.txt"
+	names, err := walkNames(fs, ".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"a.txt", "c.txt", "empty.txt"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	fs.Match = "docs/*"
+	fs.MatchPath = true
+	if names, err = walkNames(fs, "."); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"c.txt", "d.md"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	// Walking a path that does not exist on the FS is an error
+	if _, err = walkNames(fs, "missing"); err == nil {
+		t.Error("expected an error walking a missing path")
+	}
+}
+
+func TestMimeTypesFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = fstest.MapFS{
+		"page.html": {Data: []byte("<html><body>hi</body></html>")},
+		"note.txt":  {Data: []byte("just some text")},
+	}
+	fs.MimeTypes = []string{"text/html"}
+
+	names, err := walkNames(fs, ".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"page.html"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestDuplicatesFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = fstest.MapFS{
+		"a.txt":     {Data: []byte("same")},
+		"b/a.txt":   {Data: []byte("same")},
+		"c.txt":     {Data: []byte("diff")},
+		"long.txt":  {Data: []byte("different")},
+		"other.txt": {Data: []byte("other")},
+	}
+
+	groups, err := fs.Duplicates(".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group of duplicates, got %d", len(groups))
+	}
+
+	for _, group := range groups {
+		sort.Strings(group)
+		if expected := []string{"a.txt", "b/a.txt"}; !reflect.DeepEqual(group, expected) {
+			t.Errorf("expected %v, got %v", expected, group)
+		}
+	}
+}
+
+func TestLargestFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = makeMapFS()
+	fs.SkipHidden = true
+
+	largest, err := fs.Largest(2, ".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []*FileSize{{Path: "docs/c.txt", Bytes: 6}, {Path: "a.txt", Bytes: 4}}
+	if !reflect.DeepEqual(largest, expected) {
+		t.Errorf("expected %v, got %v", expected, largest)
+	}
+
+	// The stats and histogram read the sizes from the FS as well
+	stats, err := fs.CountStats(".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if stats.Files != 6 || stats.Bytes != 14 {
+		t.Errorf("expected 6 files and 14 bytes, got %d files and %d bytes", stats.Files, stats.Bytes)
+	}
+
+	hist, err := fs.Histogram([]int64{1, 5}, ".")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []uint64{1, 4, 1}; !reflect.DeepEqual(hist.Counts, expected) {
+		t.Errorf("expected counts %v, got %v", expected, hist.Counts)
+	}
+}
+
+func TestEntryFS(t *testing.T) {
+	fs := makeWalker()
+	fs.FS = makeMapFS()
+	fs.SkipHidden = true
+	fs.SkipDirNames = []string{"node_modules"}
+
+	entries, err := WalkCollect(fs, ".", fs.Entry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		sizes[entry.Path] = entry.Size
+	}
+
+	expected := map[string]int64{"a.txt": 4, "b.csv": 2, "empty.txt": 0, "docs/c.txt": 6, "docs/d.md": 1}
+	if !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected %v, got %v", expected, sizes)
+	}
+}
@@ -0,0 +1,60 @@
+package urfs
+
+// Internal helper function that expands the brace groups in a glob pattern,
+// which are not supported by filepath.Match, into multiple patterns, e.g.
+// "*.{jpg,png}" expands to "*.jpg" and "*.png". Groups may be nested and
+// alternatives may be empty, e.g. "a{,b{c,d}}" expands to "a", "abc" and
+// "abd". As in the shell, braces without a comma and unbalanced braces are
+// left as is, and braces escaped with a backslash are not expanded.
+func expandBraces(pattern string) []string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			end, alts := braceGroup(pattern, i)
+			if end < 0 || len(alts) < 2 {
+				continue
+			}
+
+			prefix, suffix := pattern[:i], pattern[end+1:]
+			patterns := make([]string, 0, len(alts))
+			for _, alt := range alts {
+				patterns = append(patterns, expandBraces(prefix+alt+suffix)...)
+			}
+			return patterns
+		}
+	}
+	return []string{pattern}
+}
+
+// Internal helper function that finds the brace that closes the group
+// opened at start, returning its index and the comma separated alternatives
+// in the group, or -1 if the group is not closed.
+func braceGroup(pattern string, start int) (int, []string) {
+	var (
+		depth int
+		last  = start + 1
+		alts  []string
+	)
+
+	for j := start + 1; j < len(pattern); j++ {
+		switch pattern[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return j, append(alts, pattern[last:j])
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, pattern[last:j])
+				last = j + 1
+			}
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,90 @@
+package urfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := map[string][]string{
+		"*":                 {"*"},
+		"*.{jpg,png}":       {"*.jpg", "*.png"},
+		"*.{jpg,png,gif}":   {"*.jpg", "*.png", "*.gif"},
+		"{a,b}{c,d}":        {"ac", "ad", "bc", "bd"},
+		"a{b,c{d,e}}f":      {"abf", "acdf", "acef"},
+		"a{,b}":             {"a", "ab"},
+		"a{}b":              {"a{}b"},
+		"{single}":          {"{single}"},
+		"{a,b":              {"{a,b"},
+		"x{a,b":             {"x{a,b"},
+		"{x{a,b}":           {"{xa", "{xb"},
+		`\{a,b\}`:           {`\{a,b\}`},
+		"{img,photo}*.jpeg": {"img*.jpeg", "photo*.jpeg"},
+	}
+
+	for pattern, expected := range tests {
+		patterns := expandBraces(pattern)
+		if strings.Join(patterns, "|") != strings.Join(expected, "|") {
+			t.Errorf("%q: expected %q, got %q", pattern, expected, patterns)
+		}
+	}
+}
+
+func TestMatchBraces(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.jpg": "a",
+		"b.png": "b",
+		"c.gif": "c",
+		"d.txt": "d",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	fs.Match = "*.{jpg,png}"
+
+	names, err := walkNames(fs, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Join(names, ",") != "a.jpg,b.png" {
+		t.Errorf("expected brace pattern to match jpg and png files, got %v", names)
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":   "a",
+		"README.md": "b",
+		"data.csv":  "c",
+		"sub/x.go":  "d",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		match    string
+		patterns []string
+		expected string
+	}{
+		{"", nil, "README.md,data.csv,main.go,x.go"},
+		{"", []string{"*.go", "*.md"}, "README.md,main.go,x.go"},
+		{"*.csv", []string{"*.md"}, "README.md,data.csv"},
+		{"*.csv", nil, "data.csv"},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		fs.Match = tc.match
+		fs.Patterns = tc.patterns
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != tc.expected {
+			t.Errorf("match %q and patterns %v: expected %s, got %v", tc.match, tc.patterns, tc.expected, names)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package urfs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultBuckets are logarithmic file size boundaries used by Histogram if
+// no buckets are specified.
+var DefaultBuckets = []int64{
+	KiB, 10 * KiB, 100 * KiB, MiB, 10 * MiB, 100 * MiB, GiB,
+}
+
+// Width of the largest bar in the rendered histogram.
+const histogramWidth = 50
+
+// Histogram computes the distribution of file sizes in each of the specified
+// paths, tallying each file into the bucket defined by the byte boundaries.
+// If no buckets are specified, the logarithmic DefaultBuckets are used.
+func (fs *FSWalker) Histogram(buckets []int64, paths ...string) (*SizeHistogram, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	hist := NewSizeHistogram(buckets)
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			info, err := fs.stat(path)
+			if err != nil {
+				return "", err
+			}
+			return hist.update(path, info)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hist, nil
+}
+
+// SizeHistogram holds the counts of files whose size falls into each bucket.
+// Bucket i counts files whose size is less than Buckets[i] (and greater than
+// or equal to the previous boundary); the final count is for all files whose
+// size is greater than or equal to the last boundary.
+type SizeHistogram struct {
+	Buckets []int64  // upper bounds (exclusive) of each bucket in bytes
+	Counts  []uint64 // number of files in each bucket, one more than buckets
+}
+
+// NewSizeHistogram creates a histogram with the specified bucket boundaries,
+// which are sorted into ascending order.
+func NewSizeHistogram(buckets []int64) *SizeHistogram {
+	bounds := make([]int64, len(buckets))
+	copy(bounds, buckets)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	return &SizeHistogram{
+		Buckets: bounds,
+		Counts:  make([]uint64, len(bounds)+1),
+	}
+}
+
+// Update the histogram from the given path, synchronizing as necessary.
+func (h *SizeHistogram) Update(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return h.update(path, info)
+}
+
+// Internal helper function that updates the histogram with the file info of
+// the path, which may be read from the walker's file system.
+func (h *SizeHistogram) update(path string, info os.FileInfo) (string, error) {
+	if info.IsDir() {
+		return "", nil
+	}
+
+	size := info.Size()
+	idx := sort.Search(len(h.Buckets), func(i int) bool { return size < h.Buckets[i] })
+	atomic.AddUint64(&h.Counts[idx], 1)
+	return path, nil
+}
+
+// Total returns the number of files counted in the histogram.
+func (h *SizeHistogram) Total() uint64 {
+	var total uint64
+	for i := range h.Counts {
+		total += atomic.LoadUint64(&h.Counts[i])
+	}
+	return total
+}
+
+// String renders the histogram as an ASCII bar chart.
+func (h *SizeHistogram) String() string {
+	// Create the labels for each of the buckets
+	labels := make([]string, len(h.Counts))
+	for i := range h.Counts {
+		if i < len(h.Buckets) {
+			labels[i] = "< " + HumanizeBytes(uint64(h.Buckets[i]))
+		} else if len(h.Buckets) > 0 {
+			labels[i] = ">= " + HumanizeBytes(uint64(h.Buckets[len(h.Buckets)-1]))
+		} else {
+			labels[i] = "all"
+		}
+	}
+
+	// Compute the widths for alignment and scale of the bars
+	var width int
+	var most uint64
+	for i, label := range labels {
+		if len(label) > width {
+			width = len(label)
+		}
+		if count := atomic.LoadUint64(&h.Counts[i]); count > most {
+			most = count
+		}
+	}
+
+	lines := make([]string, 0, len(labels))
+	for i, label := range labels {
+		count := atomic.LoadUint64(&h.Counts[i])
+
+		var bar int
+		if most > 0 {
+			bar = int(count * histogramWidth / most)
+		}
+		if bar == 0 && count > 0 {
+			bar = 1
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"%*s | %-*s %d", width, label, histogramWidth, strings.Repeat("#", bar), count,
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
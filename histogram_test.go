@@ -0,0 +1,39 @@
+package urfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"empty.txt":  "",
+		"small.txt":  "hello",
+		"medium.txt": strings.Repeat("a", 100),
+		"large.txt":  strings.Repeat("b", 2000),
+		"huge.txt":   strings.Repeat("c", 5000),
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	hist, err := fs.Histogram([]int64{1024, 10, 4096}, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []uint64{2, 1, 1, 1}
+	for i, count := range expected {
+		if hist.Counts[i] != count {
+			t.Errorf("expected %d files in bucket %d, got %d", count, i, hist.Counts[i])
+		}
+	}
+
+	if hist.Total() != 5 {
+		t.Errorf("expected 5 total files, got %d", hist.Total())
+	}
+
+	if lines := strings.Split(hist.String(), "\n"); len(lines) != 4 {
+		t.Errorf("expected 4 lines in the histogram, got %d", len(lines))
+	}
+}
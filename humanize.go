@@ -0,0 +1,119 @@
+package urfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Byte size units in powers of 1024.
+const (
+	KiB int64 = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+	PiB
+)
+
+// Maps the unit suffixes accepted by ParseBytes to their multiplier.
+var byteUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   KiB,
+	"KB":  KiB,
+	"KIB": KiB,
+	"M":   MiB,
+	"MB":  MiB,
+	"MIB": MiB,
+	"G":   GiB,
+	"GB":  GiB,
+	"GIB": GiB,
+	"T":   TiB,
+	"TB":  TiB,
+	"TIB": TiB,
+	"P":   PiB,
+	"PB":  PiB,
+	"PIB": PiB,
+}
+
+// Unit suffixes used by HumanizeBytes in increasing powers of 1024.
+var byteSuffixes = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// HumanizeBytes converts a number of bytes into a human readable string in
+// powers of 1024 with one decimal place, e.g. 1536 bytes is "1.5 KiB".
+func HumanizeBytes(n uint64) string {
+	if n < uint64(KiB) {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	val := float64(n) / float64(KiB)
+	suffix := 0
+	for val >= 1024 && suffix < len(byteSuffixes)-1 {
+		val /= 1024
+		suffix++
+	}
+
+	return fmt.Sprintf("%0.1f %s", val, byteSuffixes[suffix])
+}
+
+// ParseBytes parses a human readable size such as "1K", "10MB", or "1.5GiB"
+// into the number of bytes. Units are case insensitive and are interpreted
+// as powers of 1024; a number without a unit is a number of bytes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	// Split the string into the numeric part and the unit suffix
+	idx := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if idx < 0 {
+		idx = len(s)
+	}
+
+	num, unit := s[:idx], strings.ToUpper(strings.TrimSpace(s[idx:]))
+	mult, ok := byteUnits[unit]
+	if !ok || num == "" {
+		return 0, fmt.Errorf("could not parse %q as a size in bytes", s)
+	}
+
+	val, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q as a size in bytes", s)
+	}
+
+	return int64(val * float64(mult)), nil
+}
+
+// ParseTime parses either an RFC3339 timestamp or a relative duration before
+// now such as "7d", "2w", or "36h". In addition to the units understood by
+// time.ParseDuration, the relative form accepts days (d) and weeks (w).
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	// Handle days and weeks which are not parsed by time.ParseDuration
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit > 0 {
+		val, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil || val < 0 {
+			return time.Time{}, fmt.Errorf("could not parse %q as a time", s)
+		}
+		return now.Add(-time.Duration(val * float64(unit))), nil
+	}
+
+	dur, err := time.ParseDuration(s)
+	if err != nil || dur < 0 {
+		return time.Time{}, fmt.Errorf("could not parse %q as a time", s)
+	}
+	return now.Add(-dur), nil
+}
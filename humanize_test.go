@@ -0,0 +1,100 @@
+package urfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"1K", 1024},
+		{"1k", 1024},
+		{"1KB", 1024},
+		{"1KiB", 1024},
+		{"1.5K", 1536},
+		{"10M", 10 * 1024 * 1024},
+		{"100M", 100 * 1024 * 1024},
+		{" 1G ", 1024 * 1024 * 1024},
+		{"2TB", 2 * 1024 * 1024 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		actual, err := ParseBytes(tt.input)
+		if err != nil {
+			t.Errorf("could not parse %q: %s", tt.input, err)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("expected %q to parse to %d, got %d", tt.input, tt.expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "K", "1X", "1.2.3M", "-1K"} {
+		if _, err := ParseBytes(input); err == nil {
+			t.Errorf("expected error parsing %q", input)
+		}
+	}
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1048575, "1024.0 KiB"},
+		{1048576, "1.0 MiB"},
+		{4823749823, "4.5 GiB"},
+		{1099511627776, "1.0 TiB"},
+	}
+
+	for _, tt := range tests {
+		if actual := HumanizeBytes(tt.input); actual != tt.expected {
+			t.Errorf("expected %d to humanize to %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2017, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2017-05-01T08:30:00Z", time.Date(2017, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+		{"1.5d", now.Add(-36 * time.Hour)},
+		{"2w", now.Add(-14 * 24 * time.Hour)},
+		{"36h", now.Add(-36 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		actual, err := ParseTime(tt.input, now)
+		if err != nil {
+			t.Errorf("could not parse %q: %s", tt.input, err)
+			continue
+		}
+
+		if !actual.Equal(tt.expected) {
+			t.Errorf("expected %q to parse to %s, got %s", tt.input, tt.expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "yesterday", "d", "-7d", "2017-05-01"} {
+		if _, err := ParseTime(input, now); err == nil {
+			t.Errorf("expected error parsing %q", input)
+		}
+	}
+}
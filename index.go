@@ -0,0 +1,226 @@
+package urfs
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+//===========================================================================
+// File Index
+//===========================================================================
+
+// IndexBatch is the number of rows written by each transaction of an index,
+// trading the memory held by a transaction for fewer commits.
+const IndexBatch = 1000
+
+// The files table of the index, keyed by the path of each file. The
+// modification time is stored in nanoseconds since the Unix epoch.
+const indexSchema = `CREATE TABLE IF NOT EXISTS files (
+	path TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	modtime INTEGER NOT NULL,
+	hash TEXT NOT NULL
+)`
+
+// Inserts a file into the index, replacing the row of a file that changed.
+const indexUpsert = `INSERT OR REPLACE INTO files (path, size, modtime, hash) VALUES (?, ?, ?, ?)`
+
+// IndexEntry is a row of the index: a file and the hex SHA-256 digest of
+// its contents.
+type IndexEntry struct {
+	FileEntry
+	Hash string `json:"hash"` // hex SHA-256 digest of the contents
+}
+
+// IndexResult summarizes an update of an index.
+type IndexResult struct {
+	NumIndexed   uint64        // number of new or changed files written to the index
+	NumUnchanged uint64        // number of files skipped since they are already indexed
+	Duration     time.Duration // amount of time it took to update the index
+}
+
+// String returns a human readable summary of the update.
+func (r *IndexResult) String() string {
+	return fmt.Sprintf(
+		"indexed %d files (%d unchanged) in %s",
+		r.NumIndexed, r.NumUnchanged, r.Duration,
+	)
+}
+
+// Index walks the paths and records the path, size, modification time, and
+// SHA-256 digest of every file in the files table of the SQLite database,
+// creating the table if required, to build a searchable catalog of the
+// files. The update is incremental: files whose size and modification time
+// match their row in the index are not hashed again.
+//
+// The workers hash the files concurrently and send the rows to a single
+// goroutine that writes them in transactions of IndexBatch rows, since
+// SQLite only allows one writer at a time. If a write fails, the walk is
+// canceled and the error is returned; the rows committed before the error
+// remain in the index, so running the index again resumes the update.
+func (fs *FSWalker) Index(db *sql.DB, paths ...string) (*IndexResult, error) {
+	if _, err := db.Exec(indexSchema); err != nil {
+		return nil, fmt.Errorf("could not create index: %s", err)
+	}
+
+	known, err := readIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result := new(IndexResult)
+	rows := make(chan *IndexEntry, DefaultBuffer)
+	written := make(chan error, 1)
+	go func() {
+		written <- fs.writeIndex(db, rows, &result.NumIndexed)
+	}()
+
+	for _, path := range paths {
+		if err = fs.Walk(path, fs.indexFunc(known, rows, &result.NumUnchanged)); err != nil {
+			break
+		}
+	}
+
+	close(rows)
+	if werr := <-written; werr != nil {
+		return nil, werr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// Internal type that identifies the version of a file in the index.
+type indexStamp struct {
+	size    int64
+	modtime int64
+}
+
+// Internal helper function that reads the size and modification time of
+// every file in the index, so that unchanged files can be skipped.
+func readIndex(db *sql.DB) (map[string]indexStamp, error) {
+	rows, err := db.Query(`SELECT path, size, modtime FROM files`)
+	if err != nil {
+		return nil, fmt.Errorf("could not read index: %s", err)
+	}
+	defer rows.Close()
+
+	known := make(map[string]indexStamp)
+	for rows.Next() {
+		var path string
+		var stamp indexStamp
+		if err := rows.Scan(&path, &stamp.size, &stamp.modtime); err != nil {
+			return nil, fmt.Errorf("could not read index: %s", err)
+		}
+		known[path] = stamp
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read index: %s", err)
+	}
+	return known, nil
+}
+
+// Internal helper function that creates the WalkFunc of an index, which
+// hashes each file that is not already in the index and sends its row to
+// the writer, counting the files that are unchanged. The map of known files
+// is only read, so it is safe to share between the workers.
+func (fs *FSWalker) indexFunc(known map[string]indexStamp, rows chan<- *IndexEntry, unchanged *uint64) WalkFunc {
+	return func(path string) (string, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+
+		stamp := indexStamp{info.Size(), info.ModTime().UnixNano()}
+		if prev, ok := known[path]; ok && prev == stamp {
+			atomic.AddUint64(unchanged, 1)
+			return "", nil
+		}
+
+		digest, err := hashFile(path, sha256.New())
+		if err != nil {
+			return "", err
+		}
+
+		row := &IndexEntry{
+			FileEntry: FileEntry{Path: path, Size: info.Size(), ModTime: info.ModTime()},
+			Hash:      digest,
+		}
+
+		select {
+		case rows <- row:
+		case <-fs.ctx.Done():
+			return "", fs.ctx.Err()
+		}
+		return path, nil
+	}
+}
+
+// Internal helper function that writes the rows to the index in batched
+// transactions until the rows channel is closed, counting the rows that are
+// committed. On error the walk is canceled and the remaining rows are
+// drained so that no worker blocks sending a row.
+func (fs *FSWalker) writeIndex(db *sql.DB, rows <-chan *IndexEntry, indexed *uint64) (err error) {
+	var (
+		tx    *sql.Tx
+		stmt  *sql.Stmt
+		batch uint64
+	)
+
+	defer func() {
+		if err != nil {
+			if tx != nil {
+				tx.Rollback()
+			}
+			fs.Cancel()
+			for range rows {
+			}
+		}
+	}()
+
+	commit := func() error {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not write index: %s", err)
+		}
+		*indexed += batch
+		tx, stmt, batch = nil, nil, 0
+		return nil
+	}
+
+	for row := range rows {
+		if tx == nil {
+			if tx, err = db.Begin(); err != nil {
+				return fmt.Errorf("could not write index: %s", err)
+			}
+
+			if stmt, err = tx.Prepare(indexUpsert); err != nil {
+				return fmt.Errorf("could not write index: %s", err)
+			}
+		}
+
+		if _, err = stmt.Exec(row.Path, row.Size, row.ModTime.UnixNano(), row.Hash); err != nil {
+			return fmt.Errorf("could not index %s: %s", row.Path, err)
+		}
+
+		if batch++; batch >= IndexBatch {
+			if err = commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if tx != nil {
+		return commit()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+//go:build cgo
+// +build cgo
+
+package urfs
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Helper function that reads the hash of each file in the index by path.
+func readIndexHashes(t *testing.T, db *sql.DB) map[string]string {
+	rows, err := db.Query(`SELECT path, hash FROM files`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			t.Fatal(err.Error())
+		}
+		hashes[path] = hash
+	}
+	return hashes
+}
+
+func TestIndex(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello world",
+		"sub/b.txt": "hello there",
+		"sub/c.txt": "",
+	})
+	defer os.RemoveAll(root)
+
+	// Each connection to an in-memory database opens a new database
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	fs := makeWalker()
+	result, err := fs.Index(db, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumIndexed != 3 || result.NumUnchanged != 0 {
+		t.Errorf("expected 3 files indexed, got %s", result)
+	}
+
+	hashes := readIndexHashes(t, db)
+	expected := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	if len(hashes) != 3 || hashes[filepath.Join(root, "a.txt")] != expected {
+		t.Errorf("unexpected index %v", hashes)
+	}
+
+	// Only new and changed files are hashed again
+	changed := filepath.Join(root, "sub", "b.txt")
+	if err := ioutil.WriteFile(changed, []byte("goodbye"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "d.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result, err = fs.Index(db, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumIndexed != 2 || result.NumUnchanged != 2 {
+		t.Errorf("expected 2 files indexed and 2 unchanged, got %s", result)
+	}
+
+	hashes = readIndexHashes(t, db)
+	expected = "82e35a63ceba37e9646434c5dd412ea577147f1e4a41ccde1614253187e3dbf9"
+	if len(hashes) != 4 || hashes[changed] != expected {
+		t.Errorf("unexpected index %v", hashes)
+	}
+}
@@ -0,0 +1,44 @@
+package urfs
+
+import (
+	"io"
+	"os"
+)
+
+// Logger receives the diagnostic messages of the walker, such as the paths
+// skipped because of errors or permissions and the copies that are retried;
+// a *log.Logger satisfies the interface. Results are never logged, they are
+// returned by the methods of the walker so that library consumers decide
+// how to present them.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Internal logger that discards all messages, the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// Internal helper function that writes a diagnostic message to the Logger,
+// discarding it if the Logger has been set to nil.
+func (fs *FSWalker) logf(format string, v ...interface{}) {
+	if fs.Logger != nil {
+		fs.Logger.Printf(format, v...)
+	}
+}
+
+// Internal helper function that collects an error that does not abort the
+// walk because ContinueOnError is set, logging that the path was skipped.
+func (fs *FSWalker) collectError(err error) {
+	fs.logf("skipped after error: %s", err)
+	fs.errors.add(err)
+}
+
+// Internal helper function that returns the writer that results are printed
+// to by Count and Search if asked to, standard output unless Output is set.
+func (fs *FSWalker) output() io.Writer {
+	if fs.Output != nil {
+		return fs.Output
+	}
+	return os.Stdout
+}
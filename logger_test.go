@@ -0,0 +1,100 @@
+package urfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Helper logger that records the messages written to it.
+type recordLogger struct {
+	sync.Mutex
+	messages []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestNopLogger(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "aa",
+		"sub/b.txt": "bbb",
+	})
+	defer os.RemoveAll(root)
+
+	// Capture anything written to stdout or stderr during the count
+	out, err := ioutil.TempFile("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+
+	fs := makeWalker()
+	if _, ok := fs.Logger.(nopLogger); !ok {
+		os.Stdout, os.Stderr = stdout, stderr
+		t.Fatalf("expected the default logger to be a no-op, got %T", fs.Logger)
+	}
+
+	sizes, err := fs.Count(false, root)
+	os.Stdout, os.Stderr = stdout, stderr
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 2 || sizes[0].Bytes != 5 {
+		t.Errorf("expected 2 files and 5 bytes, got %d files and %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	if data, err := ioutil.ReadFile(out.Name()); err != nil {
+		t.Fatal(err.Error())
+	} else if len(data) > 0 {
+		t.Errorf("expected no output from the count, got %q", data)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+		"c.txt": "c",
+	})
+	defer os.RemoveAll(root)
+
+	logger := new(recordLogger)
+	fs := makeWalker()
+	fs.Logger = logger
+	fs.ContinueOnError = true
+
+	// Errors that do not abort the walk are logged as they are collected
+	err := fs.Walk(root, func(path string) (string, error) {
+		if filepath.Base(path) == "b.txt" {
+			return "", fmt.Errorf("could not process %s", path)
+		}
+		return path, nil
+	})
+
+	if _, ok := err.(WalkErrors); !ok {
+		t.Fatalf("expected walk errors, got %v", err)
+	}
+
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "could not process") {
+		t.Errorf("expected the error to be logged, got %v", logger.messages)
+	}
+
+	// A nil logger discards the messages
+	fs.Logger = nil
+	if err := fs.Walk(root, func(path string) (string, error) { return "", fmt.Errorf("failed") }); err == nil {
+		t.Error("expected walk errors with a nil logger")
+	}
+}
@@ -0,0 +1,86 @@
+package urfs
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+// ManifestHeader is the first row written to every manifest.
+var ManifestHeader = []string{"source", "destination", "bytes"}
+
+// Manifest writes a CSV record of the files copied by a sample, mapping each
+// source file to its destination along with the number of bytes in the
+// source. Because copies are made concurrently by the walker's workers, rows
+// are sent on a channel to a single goroutine that writes them to the file.
+// The manifest must be closed after all copies are complete to flush the
+// rows to disk.
+type Manifest struct {
+	Path  string // path to the CSV file the manifest is written to
+	Count uint64 // number of rows written, excluding the header
+
+	file *os.File
+	rows chan []string
+	done chan error
+}
+
+// NewManifest creates the CSV file at path, writes the header and starts
+// the goroutine that writes rows added to the manifest.
+func NewManifest(path string) (*Manifest, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Path: path,
+		file: file,
+		rows: make(chan []string, DefaultBuffer),
+		done: make(chan error, 1),
+	}
+
+	go m.write()
+	return m, nil
+}
+
+// Add a row to the manifest for the file copied from src to dst. It is safe
+// to call Add from multiple goroutines, but not after the manifest is closed.
+func (m *Manifest) Add(src, dst string, bytes int64) {
+	m.rows <- []string{src, dst, strconv.FormatInt(bytes, 10)}
+}
+
+// Close the manifest, waiting for all rows to be written then flushing and
+// closing the CSV file. Returns the first error encountered while writing.
+func (m *Manifest) Close() error {
+	close(m.rows)
+	err := <-m.done
+
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Internal helper function that writes the header then drains the rows
+// channel, writing each row to the CSV file. Once an error occurs, the
+// remaining rows are discarded so that Add does not block.
+func (m *Manifest) write() {
+	w := csv.NewWriter(m.file)
+	err := w.Write(ManifestHeader)
+
+	for row := range m.rows {
+		if err != nil {
+			continue
+		}
+
+		if err = w.Write(row); err == nil {
+			m.Count++
+		}
+	}
+
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	m.done <- err
+}
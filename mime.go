@@ -0,0 +1,51 @@
+package urfs
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Internal helper function that detects the MIME type of the file at path
+// from the first 512 bytes of its contents, returning the media type
+// without any parameters, e.g. "text/plain" rather than
+// "text/plain; charset=utf-8".
+func (fs *FSWalker) detectMimeType(path string) (string, error) {
+	f, err := fs.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	mtype := http.DetectContentType(buf[:n])
+	if idx := strings.Index(mtype, ";"); idx >= 0 {
+		mtype = mtype[:idx]
+	}
+	return strings.TrimSpace(mtype), nil
+}
+
+// Internal helper function that returns true if no MIME types are specified
+// or the detected MIME type of the file at path is one of the MimeTypes.
+func (fs *FSWalker) matchMimeType(path string) (bool, error) {
+	if len(fs.MimeTypes) == 0 {
+		return true, nil
+	}
+
+	mtype, err := fs.detectMimeType(path)
+	if err != nil {
+		return false, err
+	}
+
+	for _, allowed := range fs.MimeTypes {
+		if strings.EqualFold(strings.TrimSpace(allowed), mtype) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,120 @@
+package urfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// Move a sample of the files contained in a source directory (src) to a
+// destination directory (dst) with some probability between 0 and 1 (size),
+// preserving the relative directory structure. Files are renamed if the
+// directories are on the same file system, otherwise they are copied to the
+// destination and then removed from the source.
+func (fs *FSWalker) Move(src, dst string, size float64) (string, error) {
+	salt := fs.salt()
+
+	// Run the walk with our moving function
+	err := fs.Walk(src, func(path string) (string, error) {
+		// Get the relative path from the base
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
+
+		// If we're in the sample percent, perform the move
+		if sampleKey(salt, rel) <= size {
+			return fs.moveSample(fs.ctx, dst, rel, path)
+		}
+
+		// No work was done so return empty string
+		return "", nil
+	})
+
+	// If an error occured return it
+	if err != nil {
+		return "", err
+	}
+
+	// Otherwise return a statement of how much was moved
+	var pcent float64
+	if fs.nPaths > 0 {
+		pcent = (float64(fs.nResults) / float64(fs.nPaths)) * 100.0
+	}
+	result := fmt.Sprintf("moved %d of %d files (%0.1f%%) in %s", fs.nResults, fs.nPaths, pcent, fs.duration)
+	return result, nil
+}
+
+// CountMove counts the number of files and bytes that Move would move from
+// the source directory (src) with the sample size without moving anything,
+// e.g. to confirm the move before it is made. Set the walker's Seed so that
+// the count and the move select the same files.
+func (fs *FSWalker) CountMove(src string, size float64) (*DirSize, error) {
+	salt := fs.salt()
+	count := &DirSize{Path: src}
+
+	err := fs.Walk(src, func(path string) (string, error) {
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
+
+		if sampleKey(salt, rel) <= size {
+			return count.Update(path)
+		}
+		return "", nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return count, nil
+}
+
+// Internal helper function that moves the path to the relative path (rel) in
+// the dst directory, creating any intermediate directories as needed. Falls
+// back to copy and remove if the rename crosses file systems. Returns the
+// path to the moved file.
+func (fs *FSWalker) moveSample(ctx context.Context, dst, rel, path string) (string, error) {
+	// Create the new path to the destination
+	drl := filepath.Join(dst, rel)
+
+	// Create the directory if it doesn't exist
+	if err := Mkdir(filepath.Dir(drl)); err != nil {
+		return "", err
+	}
+
+	// Attempt to rename the file to the destination
+	err := os.Rename(path, drl)
+	if err == nil {
+		return drl, nil
+	}
+
+	if !isCrossDevice(err) {
+		return "", err
+	}
+
+	// Copy the file across devices, preserving its metadata
+	if err = copyFileMeta(ctx, drl, path, fs.limiter, nil); err != nil {
+		return "", err
+	}
+
+	// Remove the original file once it has been copied
+	if err = os.Remove(path); err != nil {
+		return "", err
+	}
+
+	return drl, nil
+}
+
+// Internal helper function that determines if the error returned from
+// os.Rename was caused by moving the file across devices.
+func isCrossDevice(err error) bool {
+	if lerr, ok := err.(*os.LinkError); ok {
+		return lerr.Err == syscall.EXDEV
+	}
+	return false
+}
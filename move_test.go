@@ -0,0 +1,113 @@
+package urfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMove(t *testing.T) {
+	src := makeSampleTree(t, 30)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Seed = 42
+	if _, err := fs.Move(src, dst, 0.5); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	moved := listFiles(t, dst)
+	remaining := listFiles(t, src)
+
+	if len(moved)+len(remaining) != 30 {
+		t.Fatalf("expected 30 files total, got %d moved and %d remaining", len(moved), len(remaining))
+	}
+
+	if uint64(len(moved)) != fs.NumResults() {
+		t.Errorf("expected %d files moved, found %d", fs.NumResults(), len(moved))
+	}
+
+	// ensure no file exists in both the source and destination
+	for _, rel := range moved {
+		if PathExists(filepath.Join(src, rel)) {
+			t.Errorf("moved file %s still exists in source", rel)
+		}
+	}
+}
+
+func TestMoveEmpty(t *testing.T) {
+	src, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	result, err := fs.Move(src, dst, 0.5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !strings.HasPrefix(result, "moved 0 of 0 files (0.0%)") {
+		t.Errorf("unexpected summary of an empty move: %q", result)
+	}
+}
+
+func TestCountMove(t *testing.T) {
+	src := makeSampleTree(t, 50)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	// With the same seed, the count matches the files that are moved
+	fs := makeWalker()
+	fs.Seed = 42
+	count, err := fs.CountMove(src, 0.3)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if count.Files == 0 || count.Files == 50 {
+		t.Fatalf("expected a sample of the files to be counted, got %d", count.Files)
+	}
+
+	if len(listFiles(t, src)) != 50 {
+		t.Fatal("expected the count not to move any files")
+	}
+
+	if _, err := fs.Move(src, dst, 0.3); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var bytes uint64
+	moved := listFiles(t, dst)
+	for _, path := range moved {
+		info, err := os.Stat(filepath.Join(dst, path))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		bytes += uint64(info.Size())
+	}
+
+	if uint64(len(moved)) != count.Files || bytes != count.Bytes {
+		t.Errorf("counted %d files and %d bytes, moved %d files and %d bytes", count.Files, count.Bytes, len(moved), bytes)
+	}
+}
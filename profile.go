@@ -0,0 +1,183 @@
+package urfs
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProfileInterval is the interval at which the paths channel is sampled
+// when profiling the walk.
+const ProfileInterval = time.Millisecond
+
+// WalkProfile describes how well the pool of workers kept up with the paths
+// discovered by the walks of a walker with Profile set, accumulated across
+// all of the walks, to help choose the number of workers and buffer size.
+type WalkProfile struct {
+	Walks       int           // number of walks profiled
+	Duration    time.Duration // total wall time of the walks
+	Samples     uint64        // number of times the paths channel was sampled
+	Full        uint64        // samples in which the paths channel was full
+	Empty       uint64        // samples in which the paths channel was empty while discovering paths
+	MaxPaths    int           // maximum number of paths waiting in the channel
+	Buffer      int           // capacity of the paths channel
+	Workers     int           // maximum number of workers started by a walk
+	MaxWorkers  int           // maximum number of workers allowed
+	IdleWorkers uint64        // workers that waited for paths while paths were still being discovered
+}
+
+// FullPercent returns the percent of the samples in which the paths channel
+// was full, e.g. in which the walk was waiting on the workers.
+func (p *WalkProfile) FullPercent() float64 {
+	if p.Samples == 0 {
+		return 0
+	}
+	return float64(p.Full) / float64(p.Samples) * 100
+}
+
+// EmptyPercent returns the percent of the samples in which the paths channel
+// was empty while paths were still being discovered, e.g. in which the
+// workers were waiting on the walk.
+func (p *WalkProfile) EmptyPercent() float64 {
+	if p.Samples == 0 {
+		return 0
+	}
+	return float64(p.Empty) / float64(p.Samples) * 100
+}
+
+// Suggestion returns a short suggestion for tuning the walker.
+func (p *WalkProfile) Suggestion() string {
+	switch full, empty := p.FullPercent(), p.EmptyPercent(); {
+	case p.Samples == 0:
+		return "the walks were too short to profile"
+	case full >= 50 && p.Workers >= p.MaxWorkers:
+		return fmt.Sprintf("paths channel was full %0.0f%% of the time; consider more workers or a larger buffer", full)
+	case full >= 50:
+		return fmt.Sprintf("paths channel was full %0.0f%% of the time; consider a larger buffer", full)
+	case empty >= 50:
+		return fmt.Sprintf("paths channel was empty %0.0f%% of the time; the walk is limited by listing directories, so more workers will not help", empty)
+	default:
+		return "the workers kept up with the walk; the current settings are balanced"
+	}
+}
+
+// String returns a summary of the profile followed by the suggestion.
+func (p *WalkProfile) String() string {
+	return fmt.Sprintf(
+		"profiled %d walks in %s: at most %d of %d paths waiting, %d of %d workers started, %d idle while discovering paths\n%s",
+		p.Walks, p.Duration, p.MaxPaths, p.Buffer, p.Workers, p.MaxWorkers, p.IdleWorkers, p.Suggestion(),
+	)
+}
+
+// Internal profiler that samples the paths channel during a walk and counts
+// the workers that go idle. All of its methods are safe to call on a nil
+// profiler, which does nothing, so that the overhead is negligible when the
+// walk is not being profiled.
+type profiler struct {
+	sync.Mutex
+	profile     WalkProfile
+	discovering int32         // set while the producer is discovering paths
+	stop        chan struct{} // closed to stop sampling the current walk
+	stopped     chan struct{} // closed when sampling the current walk has stopped
+	started     time.Time     // time the current walk started
+}
+
+// Internal helper function that starts profiling a walk, sampling the paths
+// channel until the returned function is called when the walk is complete.
+func (fs *FSWalker) startProfile() func() {
+	if fs.prof == nil {
+		fs.prof = new(profiler)
+	}
+
+	p := fs.prof
+	atomic.StoreInt32(&p.discovering, 1)
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	p.started = time.Now()
+
+	paths := fs.paths
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(ProfileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.sample(len(paths), cap(paths))
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(p.stop)
+		<-p.stopped
+
+		p.Lock()
+		defer p.Unlock()
+		p.profile.Walks++
+		p.profile.Duration += time.Since(p.started)
+		p.profile.Buffer = cap(paths)
+		p.profile.MaxWorkers = fs.Workers
+		if fs.nWorkers > p.profile.Workers {
+			p.profile.Workers = fs.nWorkers
+		}
+	}
+}
+
+// Internal helper function that records a sample of the paths channel.
+func (p *profiler) sample(n, capacity int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.profile.Samples++
+	if n >= capacity {
+		p.profile.Full++
+	}
+
+	if n == 0 && atomic.LoadInt32(&p.discovering) == 1 {
+		p.profile.Empty++
+	}
+
+	if n > p.profile.MaxPaths {
+		p.profile.MaxPaths = n
+	}
+}
+
+// Internal helper function that records that the producer is done.
+func (p *profiler) done() {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt32(&p.discovering, 0)
+}
+
+// Internal helper function that is called by a worker before it waits for
+// the next path, counting the worker as idle the first time it waits on an
+// empty paths channel while paths are still being discovered.
+func (p *profiler) wait(n int, idle *bool) {
+	if p == nil || *idle || n > 0 || atomic.LoadInt32(&p.discovering) == 0 {
+		return
+	}
+
+	*idle = true
+	p.Lock()
+	p.profile.IdleWorkers++
+	p.Unlock()
+}
+
+// WalkProfile returns the profile of the walks since Profile was set, or nil
+// if no walks have been profiled.
+func (fs *FSWalker) WalkProfile() *WalkProfile {
+	if fs.prof == nil {
+		return nil
+	}
+
+	fs.prof.Lock()
+	defer fs.prof.Unlock()
+	profile := fs.prof.profile
+	return &profile
+}
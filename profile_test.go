@@ -0,0 +1,85 @@
+package urfs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWalkProfile(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("file%02d.txt", i)] = "a"
+	}
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	slow := func(path string) (string, error) {
+		time.Sleep(5 * time.Millisecond)
+		return path, nil
+	}
+
+	// walks are not profiled by default
+	fs := makeWalker()
+	if err := fs.Walk(root, slow); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.WalkProfile() != nil {
+		t.Error("expected no profile if not profiling")
+	}
+
+	// a single slow worker with a small buffer cannot keep up with the walk
+	fs = makeWalker()
+	fs.Workers = 1
+	fs.Buffer = 2
+	fs.Profile = true
+	fs.Reset(context.Background())
+
+	for i := 0; i < 2; i++ {
+		if err := fs.Walk(root, slow); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	profile := fs.WalkProfile()
+	if profile == nil {
+		t.Fatal("expected a profile of the walks")
+	}
+
+	if profile.Walks != 2 || profile.Samples == 0 || profile.Buffer != 2 || profile.MaxPaths != 2 {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+
+	if profile.Workers != 1 || profile.MaxWorkers != 1 {
+		t.Errorf("expected 1 of 1 workers, got %d of %d", profile.Workers, profile.MaxWorkers)
+	}
+
+	if profile.FullPercent() < 50 || !strings.Contains(profile.Suggestion(), "consider more workers") {
+		t.Errorf("expected a full channel to suggest more workers, got %s", profile)
+	}
+}
+
+func TestWalkProfileSuggestion(t *testing.T) {
+	tests := []struct {
+		profile  WalkProfile
+		expected string
+	}{
+		{WalkProfile{}, "too short to profile"},
+		{WalkProfile{Samples: 10, Full: 8, Workers: 4, MaxWorkers: 4}, "full 80% of the time; consider more workers or a larger buffer"},
+		{WalkProfile{Samples: 10, Full: 8, Workers: 2, MaxWorkers: 4}, "full 80% of the time; consider a larger buffer"},
+		{WalkProfile{Samples: 10, Empty: 9, Workers: 4, MaxWorkers: 4}, "more workers will not help"},
+		{WalkProfile{Samples: 10, Full: 2, Empty: 2}, "balanced"},
+	}
+
+	for _, tc := range tests {
+		if suggestion := tc.profile.Suggestion(); !strings.Contains(suggestion, tc.expected) {
+			t.Errorf("expected suggestion to contain %q, got %q", tc.expected, suggestion)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PruneEmpty removes the empty directories under each of the paths,
+// returning the paths of the directories that were removed. Directories
+// that only contain empty directories are also removed, so that nested
+// empty trees are fully collapsed, but the paths themselves are not. Hidden
+// directories are neither removed nor descended into if SkipHidden is set,
+// so a directory containing one is not empty. If DryRun is set, the
+// directories that would be removed are returned without removing them.
+func (fs *FSWalker) PruneEmpty(paths ...string) ([]string, error) {
+	removed := make([]string, 0)
+	for _, root := range paths {
+		pruned, err := fs.pruneEmpty(root)
+		removed = append(removed, pruned...)
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Internal helper function that collects the directories under the root
+// top-down, then checks them in reverse order so that every directory is
+// checked after all of its subdirectories. A directory is empty if all of
+// its entries are directories that have already been pruned.
+func (fs *FSWalker) pruneEmpty(root string) ([]string, error) {
+	dirs := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() || path == root {
+			return nil
+		}
+
+		if hidden, err := fs.hidden(info.Name()); err != nil {
+			return err
+		} else if hidden {
+			return filepath.SkipDir
+		}
+
+		dirs = append(dirs, path)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := make(map[string]bool)
+	removed := make([]string, 0)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		empty, err := isPruned(dirs[i], pruned)
+		if err != nil {
+			return removed, err
+		}
+
+		if !empty {
+			continue
+		}
+
+		if !fs.DryRun {
+			if err := os.Remove(dirs[i]); err != nil {
+				return removed, err
+			}
+		}
+
+		pruned[dirs[i]] = true
+		removed = append(removed, dirs[i])
+	}
+
+	return removed, nil
+}
+
+// Internal helper function that returns true if all of the entries in the
+// directory have been pruned, e.g. if the directory is empty.
+func isPruned(dir string, pruned map[string]bool) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		if !pruned[filepath.Join(dir, name)] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
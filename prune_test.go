@@ -0,0 +1,66 @@
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPruneEmpty(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"keep/a.txt":      "a",
+		"mixed/b/c.txt":   "c",
+		".git/objects/.x": "x",
+	})
+	defer os.RemoveAll(root)
+
+	// create a three level empty tree and an empty sibling next to a file
+	for _, dir := range []string{"x/y/z", "mixed/empty", "keep/.hidden"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// a dry run does not remove anything
+	fs := makeWalker()
+	fs.DryRun = true
+	removed, err := fs.PruneEmpty(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(removed) != 4 || !PathExists(filepath.Join(root, "x", "y", "z")) {
+		t.Fatalf("expected dry run to find 4 directories without removing them, got %v", removed)
+	}
+
+	fs = makeWalker()
+	removed, err = fs.PruneEmpty(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rels := make([]string, 0, len(removed))
+	for _, path := range removed {
+		rel, _ := filepath.Rel(root, path)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+
+	// children are removed before their parents
+	if strings.Join(rels, ",") != "x/y/z,x/y,x,mixed/empty" {
+		t.Errorf("unexpected removed directories: %v", rels)
+	}
+
+	for _, dir := range []string{"x", "mixed/empty"} {
+		if PathExists(filepath.Join(root, filepath.FromSlash(dir))) {
+			t.Errorf("expected %s to be removed", dir)
+		}
+	}
+
+	// the root, non-empty, and hidden directories are kept
+	for _, dir := range []string{"", "keep", "keep/.hidden", "mixed/b", ".git/objects"} {
+		if !PathExists(filepath.Join(root, filepath.FromSlash(dir))) {
+			t.Errorf("expected %q to be kept", dir)
+		}
+	}
+}
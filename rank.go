@@ -0,0 +1,170 @@
+package urfs
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Newest returns the n most recently modified files in the specified paths,
+// sorted newest first. Only the n newest files seen so far are kept in
+// memory during the walk, so the memory used is bounded regardless of the
+// number of files in the paths.
+func (fs *FSWalker) Newest(n int, paths ...string) ([]string, error) {
+	items, err := fs.rank(n, func(info os.FileInfo) int64 {
+		return info.ModTime().UnixNano()
+	}, paths...)
+
+	if err != nil {
+		return nil, err
+	}
+	return rankPaths(items), nil
+}
+
+// Oldest returns the n least recently modified files in the specified paths,
+// sorted oldest first, keeping memory bounded as Newest does.
+func (fs *FSWalker) Oldest(n int, paths ...string) ([]string, error) {
+	items, err := fs.rank(n, func(info os.FileInfo) int64 {
+		return -info.ModTime().UnixNano()
+	}, paths...)
+
+	if err != nil {
+		return nil, err
+	}
+	return rankPaths(items), nil
+}
+
+// Largest returns the n biggest files in the specified paths along with
+// their size in bytes, sorted largest first, keeping memory bounded as
+// Newest does.
+func (fs *FSWalker) Largest(n int, paths ...string) ([]*FileSize, error) {
+	items, err := fs.rank(n, func(info os.FileInfo) int64 {
+		return info.Size()
+	}, paths...)
+
+	if err != nil {
+		return nil, err
+	}
+	return rankSizes(items), nil
+}
+
+// Smallest returns the n smallest files in the specified paths along with
+// their size in bytes, sorted smallest first, keeping memory bounded as
+// Newest does.
+func (fs *FSWalker) Smallest(n int, paths ...string) ([]*FileSize, error) {
+	items, err := fs.rank(n, func(info os.FileInfo) int64 {
+		return -info.Size()
+	}, paths...)
+
+	if err != nil {
+		return nil, err
+	}
+	return rankSizes(items), nil
+}
+
+// FileSize holds the size of a single file.
+type FileSize struct {
+	Path  string `json:"path"`  // path to the file
+	Bytes int64  `json:"bytes"` // number of bytes in the file
+}
+
+// String returns the human readable size and the path of the file.
+func (s *FileSize) String() string {
+	return fmt.Sprintf("%10s  %s", HumanizeBytes(uint64(s.Bytes)), s.Path)
+}
+
+// Internal helper function that walks the paths, keeping the n files with
+// the largest keys in a bounded min-heap that is synchronized between the
+// workers. Returns the items sorted by key descending; ties are broken by
+// path so that the result is deterministic.
+func (fs *FSWalker) rank(n int, key func(info os.FileInfo) int64, paths ...string) ([]rankItem, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("count must be greater than zero")
+	}
+
+	var (
+		mu    sync.Mutex
+		ranks = make(rankHeap, 0, n)
+	)
+
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			info, err := fs.stat(path)
+			if err != nil {
+				return "", err
+			}
+
+			item := rankItem{key: key(info), path: path, info: info}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(ranks) < n {
+				heap.Push(&ranks, item)
+			} else if ranks.less(ranks[0], item) {
+				ranks[0] = item
+				heap.Fix(&ranks, 0)
+			}
+
+			return path, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := []rankItem(ranks)
+	sort.Slice(items, func(i, j int) bool { return ranks.less(items[j], items[i]) })
+	return items, nil
+}
+
+// Internal helper function that returns the paths of the ranked items.
+func rankPaths(items []rankItem) []string {
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, item.path)
+	}
+	return paths
+}
+
+// Internal helper function that returns the sizes of the ranked items.
+func rankSizes(items []rankItem) []*FileSize {
+	sizes := make([]*FileSize, 0, len(items))
+	for _, item := range items {
+		sizes = append(sizes, &FileSize{Path: item.path, Bytes: item.info.Size()})
+	}
+	return sizes
+}
+
+// Internal type that holds a file ranked by a key.
+type rankItem struct {
+	key  int64       // key the file is ranked by
+	path string      // complete path to the file
+	info os.FileInfo // info of the file when it was ranked
+}
+
+// Internal min-heap of ranked items ordered by key, implements heap.Interface.
+type rankHeap []rankItem
+
+func (h rankHeap) Len() int            { return len(h) }
+func (h rankHeap) Less(i, j int) bool  { return h.less(h[i], h[j]) }
+func (h rankHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *rankHeap) Push(x interface{}) { *h = append(*h, x.(rankItem)) }
+func (h *rankHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Internal helper that orders items by key, breaking ties by path so that
+// the lesser of two items with equal keys has the greater path.
+func (h rankHeap) less(a, b rankItem) bool {
+	if a.key == b.key {
+		return a.path > b.path
+	}
+	return a.key < b.key
+}
@@ -0,0 +1,108 @@
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function that creates a tree of files modified one hour apart in
+// the order of the names, e.g. the last name is the most recently modified.
+func makeAgedTree(t *testing.T, names ...string) string {
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		files[name] = name
+	}
+
+	root := makeTree(t, files)
+	now := time.Now()
+	for i, name := range names {
+		mtime := now.Add(time.Duration(i-len(names)) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return root
+}
+
+func TestNewestOldest(t *testing.T) {
+	root := makeAgedTree(t, "a.txt", "sub/b.txt", "c.txt", "sub/d.txt", "e.txt")
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name     string
+		rank     func(fs *FSWalker, n int, paths ...string) ([]string, error)
+		n        int
+		expected []string
+	}{
+		{"newest", (*FSWalker).Newest, 2, []string{"e.txt", "sub/d.txt"}},
+		{"oldest", (*FSWalker).Oldest, 3, []string{"a.txt", "sub/b.txt", "c.txt"}},
+		{"all", (*FSWalker).Newest, 10, []string{"e.txt", "sub/d.txt", "c.txt", "sub/b.txt", "a.txt"}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		paths, err := tc.rank(fs, tc.n, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(paths) != len(tc.expected) {
+			t.Errorf("%s: expected %d paths, got %v", tc.name, len(tc.expected), paths)
+			continue
+		}
+
+		for i, rel := range tc.expected {
+			if paths[i] != filepath.Join(root, rel) {
+				t.Errorf("%s: expected %s at %d, got %s", tc.name, rel, i, paths[i])
+			}
+		}
+	}
+
+	fs := makeWalker()
+	if _, err := fs.Newest(0, root); err == nil {
+		t.Error("expected error for non-positive count")
+	}
+}
+
+func TestLargestSmallest(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"empty.txt":      "",
+		"small.txt":      strings.Repeat("a", 10),
+		"sub/medium.txt": strings.Repeat("b", 100),
+		"large.txt":      strings.Repeat("c", 1000),
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name     string
+		rank     func(fs *FSWalker, n int, paths ...string) ([]*FileSize, error)
+		n        int
+		expected []string
+		bytes    []int64
+	}{
+		{"largest", (*FSWalker).Largest, 2, []string{"large.txt", "sub/medium.txt"}, []int64{1000, 100}},
+		{"smallest", (*FSWalker).Smallest, 3, []string{"empty.txt", "small.txt", "sub/medium.txt"}, []int64{0, 10, 100}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		sizes, err := tc.rank(fs, tc.n, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(sizes) != len(tc.expected) {
+			t.Errorf("%s: expected %d sizes, got %d", tc.name, len(tc.expected), len(sizes))
+			continue
+		}
+
+		for i, rel := range tc.expected {
+			if sizes[i].Path != filepath.Join(root, rel) || sizes[i].Bytes != tc.bytes[i] {
+				t.Errorf("%s: expected %s (%d bytes) at %d, got %s (%d bytes)", tc.name, rel, tc.bytes[i], i, sizes[i].Path, sizes[i].Bytes)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package urfs
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// Internal helper function that returns a limiter shared by the workers for
+// the specified rate in bytes per second, or nil if the rate is unlimited.
+// The burst is one second of bytes, but the limiter starts empty so that the
+// first copies are limited to the rate as well.
+func newRateLimiter(bps int64) *rate.Limiter {
+	if bps <= 0 {
+		return nil
+	}
+
+	burst := math.MaxInt32
+	if bps < int64(burst) {
+		burst = int(bps)
+	}
+
+	lim := rate.NewLimiter(rate.Limit(bps), burst)
+	lim.AllowN(time.Now(), burst)
+	return lim
+}
+
+// Internal helper function that waits until n bytes are allowed by the
+// limiter or the context is done, waiting for at most the burst of the
+// limiter at a time since WaitN fails for more. A nil limiter never waits.
+func waitBytes(ctx context.Context, lim *rate.Limiter, n int) error {
+	if lim == nil {
+		return nil
+	}
+
+	for burst := lim.Burst(); n > 0; n -= burst {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+
+		if err := lim.WaitN(ctx, chunk); err != nil {
+			// WaitN fails immediately if the wait would pass the deadline of
+			// the context, so wait for the deadline to return its error.
+			if _, ok := ctx.Deadline(); ok && ctx.Err() == nil {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+	return nil
+}
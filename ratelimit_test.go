@@ -0,0 +1,84 @@
+package urfs
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWaitBytes(t *testing.T) {
+	if lim := newRateLimiter(0); lim != nil {
+		t.Error("expected no limiter for an unlimited rate")
+	}
+
+	// a nil limiter never waits
+	if err := waitBytes(context.Background(), nil, 1<<30); err != nil {
+		t.Error(err.Error())
+	}
+
+	// waits longer than the burst are split into chunks of the burst
+	lim := newRateLimiter(1000)
+	started := time.Now()
+	if err := waitBytes(context.Background(), lim, 1200); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if elapsed := time.Since(started); elapsed < 1100*time.Millisecond {
+		t.Errorf("expected 1200 bytes at 1000 bytes per second to take 1.2s, took %s", elapsed)
+	}
+
+	// a canceled context stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := waitBytes(ctx, newRateLimiter(1), 1000); err != context.Canceled {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+
+	// a wait past the deadline returns the error of the context
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := waitBytes(ctx, newRateLimiter(1), 1); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+}
+
+func TestSampleRateLimit(t *testing.T) {
+	// Create 8 files of 8 KiB for a total of 64 KiB
+	files := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		files[name+".txt"] = strings.Repeat(name, int(8*KiB))
+	}
+
+	src := makeTree(t, files)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	// At 128 KiB per second the copies should take at least half a second
+	fs := makeWalker()
+	fs.RateLimit = 128 * KiB
+
+	started := time.Now()
+	if _, err := fs.Sample(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+	elapsed := time.Since(started)
+
+	if elapsed < 450*time.Millisecond {
+		t.Errorf("expected rate limited copies to take at least 500ms, took %s", elapsed)
+	}
+
+	if copied := listFiles(t, dst); len(copied) != len(files) {
+		t.Errorf("expected %d files copied, got %d", len(files), len(copied))
+	}
+}
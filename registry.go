@@ -0,0 +1,124 @@
+package urfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//===========================================================================
+// WalkFunc Registry
+//===========================================================================
+
+// The registry of named operations that can be looked up and applied by
+// name, e.g. by the run command, so that programs embedding urfs can add
+// their own operations without forking the command line utility. Each
+// operation is stored as a func that binds it to the walker that applies it,
+// so that built-in operations can use the walker's settings.
+var (
+	registry   = make(map[string]func(fs *FSWalker) WalkFunc)
+	registryMu sync.RWMutex
+)
+
+// RegistrySample is the probability with which the registered sample
+// operation selects each file, the same as the default of the sample command.
+const RegistrySample = 0.1
+
+// Register the built-in operations. Each returns a line of output per file:
+// count returns the size and path of the file, hash returns the SHA-256
+// digest and path as sha256sum does, and sample returns the path of a
+// uniform random sample of the files without copying them, which is
+// reproducible if the walker's Seed is set.
+func init() {
+	RegisterWalkFunc("count", func(path string) (string, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d\t%s", info.Size(), path), nil
+	})
+
+	RegisterWalkFunc("hash", func(path string) (string, error) {
+		digest, err := hashFile(path, sha256.New())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s  %s", digest, path), nil
+	})
+
+	register("sample", func(fs *FSWalker) WalkFunc {
+		salt := fs.salt()
+		return func(path string) (string, error) {
+			if sampleKey(salt, path) < RegistrySample {
+				return path, nil
+			}
+			return "", nil
+		}
+	})
+}
+
+// RegisterWalkFunc registers the function as the operation with the name,
+// replacing any operation already registered with that name. It is safe to
+// call from multiple goroutines, but is usually called from an init func.
+// Panics if the name is empty or the function is nil.
+func RegisterWalkFunc(name string, fn WalkFunc) {
+	if name == "" {
+		panic("urfs: cannot register a WalkFunc without a name")
+	}
+
+	if fn == nil {
+		panic("urfs: cannot register a nil WalkFunc as " + name)
+	}
+
+	register(name, func(*FSWalker) WalkFunc { return fn })
+}
+
+// Internal helper function that registers the func binding the operation
+// with the name to a walker.
+func register(name string, bind func(fs *FSWalker) WalkFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = bind
+}
+
+// LookupWalkFunc returns the function registered with the name, or an error
+// listing the registered operations if there is no such operation. Use the
+// walker's LookupWalkFunc method instead for a sample reproducible with the
+// walker's Seed.
+func LookupWalkFunc(name string) (WalkFunc, error) {
+	return new(FSWalker).LookupWalkFunc(name)
+}
+
+// LookupWalkFunc returns the function registered with the name bound to the
+// walker, so that the built-in sample operation uses the walker's Seed, or an
+// error listing the registered operations if there is no such operation.
+func (fs *FSWalker) LookupWalkFunc(name string) (WalkFunc, error) {
+	registryMu.RLock()
+	bind, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown operation %q, specify one of %s",
+			name, strings.Join(RegisteredWalkFuncs(), ", "),
+		)
+	}
+	return bind(fs), nil
+}
+
+// RegisteredWalkFuncs returns the sorted names of the registered operations.
+func RegisteredWalkFuncs() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
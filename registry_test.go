@@ -0,0 +1,114 @@
+package urfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterWalkFunc(t *testing.T) {
+	// The built-in operations are registered
+	for _, name := range []string{"count", "hash", "sample"} {
+		if _, err := LookupWalkFunc(name); err != nil {
+			t.Errorf("expected %s to be registered: %s", name, err)
+		}
+	}
+
+	RegisterWalkFunc("test-upper", func(path string) (string, error) {
+		return strings.ToUpper(filepath.Base(path)), nil
+	})
+
+	fn, err := LookupWalkFunc("test-upper")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if r, err := fn("/tmp/a.txt"); err != nil || r != "A.TXT" {
+		t.Errorf("expected A.TXT, got %q (%v)", r, err)
+	}
+
+	if names := RegisteredWalkFuncs(); !reflect.DeepEqual(names, []string{"count", "hash", "sample", "test-upper"}) {
+		t.Errorf("unexpected registered operations %v", names)
+	}
+
+	// Unknown operations are an error that lists the registered operations
+	if _, err := LookupWalkFunc("missing"); err == nil {
+		t.Error("expected an error looking up an unknown operation")
+	} else if !strings.Contains(err.Error(), "count, hash, sample") {
+		t.Errorf("expected the error to list the operations, got %q", err)
+	}
+
+	// Registering without a name or function panics
+	for _, tc := range []struct {
+		name string
+		fn   WalkFunc
+	}{{"", fn}, {"nil", nil}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %q to panic", tc.name)
+				}
+			}()
+			RegisterWalkFunc(tc.name, tc.fn)
+		}()
+	}
+}
+
+func TestRegistryCount(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aaa"})
+	defer os.RemoveAll(root)
+
+	fn, err := LookupWalkFunc("count")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	path := filepath.Join(root, "a.txt")
+	if r, err := fn(path); err != nil || r != fmt.Sprintf("3\t%s", path) {
+		t.Errorf("unexpected count result %q (%v)", r, err)
+	}
+}
+
+func TestRegistrySample(t *testing.T) {
+	// Helper function that returns the paths selected by the sample operation
+	sample := func(seed int64) []string {
+		fs := makeWalker()
+		fs.Seed = seed
+
+		fn, err := fs.LookupWalkFunc("sample")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		selected := make([]string, 0)
+		for i := 0; i < 1000; i++ {
+			r, err := fn(fmt.Sprintf("/data/file%04d.txt", i))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if r != "" {
+				selected = append(selected, r)
+			}
+		}
+		return selected
+	}
+
+	// The sample selects roughly RegistrySample of the files
+	first := sample(42)
+	if len(first) < 50 || len(first) > 150 {
+		t.Errorf("expected about 100 of 1000 files to be selected, got %d", len(first))
+	}
+
+	// The same seed selects the same files and a different seed does not
+	if second := sample(42); !reflect.DeepEqual(first, second) {
+		t.Error("expected the same files to be selected with the same seed")
+	}
+
+	if other := sample(7); reflect.DeepEqual(first, other) {
+		t.Error("expected different files to be selected with a different seed")
+	}
+}
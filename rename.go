@@ -0,0 +1,123 @@
+package urfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// RenameFunc returns the name that a file copied by a sample is given in
+// the destination directory. It is called concurrently by the workers.
+type RenameFunc func(file *RenameFile) (string, error)
+
+// RenameFile describes a file copied by a sample that is being renamed.
+type RenameFile struct {
+	Index uint64 // index of the file in the sample, starting at 1
+	Base  string // name of the source file without its extension
+	Ext   string // extension of the source file, including the leading dot
+
+	path string // path to the source file that is hashed
+	hash string // hex SHA-256 digest of the contents, computed when required
+}
+
+// Hash returns the hex SHA-256 digest of the contents of the source file.
+// The file is only read if the template uses the hash.
+func (f *RenameFile) Hash() (string, error) {
+	if f.hash == "" {
+		digest, err := hashFile(f.path, sha256.New())
+		if err != nil {
+			return "", err
+		}
+		f.hash = digest
+	}
+	return f.hash, nil
+}
+
+// RenameTemplate returns a RenameFunc that executes the text/template
+// format with each RenameFile, e.g. `img_{{printf "%04d" .Index}}{{.Ext}}`
+// names the files img_0001.jpg, img_0002.jpg, and so on. The template is
+// executed with an example file to ensure that it only references the
+// fields of the RenameFile, so that a bad format is reported before
+// sampling.
+func RenameTemplate(format string) (RenameFunc, error) {
+	tmpl, err := template.New("rename").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse rename format: %s", err)
+	}
+
+	example := &RenameFile{Index: 1, Base: "example", Ext: ".txt", hash: strings.Repeat("0", 64)}
+	if err = tmpl.Execute(ioutil.Discard, example); err != nil {
+		return nil, fmt.Errorf("could not execute rename format: %s", err)
+	}
+
+	return func(file *RenameFile) (string, error) {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, file); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}, nil
+}
+
+// Internal helper function that replaces the name of the file at the
+// relative path (rel) with the name returned by the RenameFunc, giving the
+// file the next index of the sample. The digest of the contents is used for
+// the hash if it has already been computed. Returns an error if the name is
+// empty, is not a plain file name, or has already been used by another file
+// in the same directory of the sample. The name is reserved until the copy
+// is committed or abandoned with commitRename, which must be called before
+// the next file is renamed, so files are renamed one at a time.
+func (fs *FSWalker) rename(rel, path, digest string) (string, error) {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+
+	fs.flatMu.Lock()
+	index := fs.nRenamed + 1
+	fs.flatMu.Unlock()
+
+	file := &RenameFile{
+		Index: index,
+		Base:  strings.TrimSuffix(name, ext),
+		Ext:   ext,
+		path:  path,
+		hash:  digest,
+	}
+
+	renamed, err := fs.Rename(file)
+	if err != nil {
+		return "", err
+	}
+
+	if renamed == "" || renamed == "." || renamed == ".." || strings.ContainsAny(renamed, `/\`) {
+		return "", fmt.Errorf("rename of %s produced an invalid name %q", path, renamed)
+	}
+
+	rel = filepath.Join(filepath.Dir(rel), renamed)
+
+	fs.flatMu.Lock()
+	defer fs.flatMu.Unlock()
+
+	if fs.renamed[rel] {
+		return "", fmt.Errorf("rename of %s produced the duplicate name %q", path, renamed)
+	}
+	fs.renamed[rel] = true
+	return rel, nil
+}
+
+// Internal helper function that commits the renamed relative path (rel) if
+// the file was copied, using up its index so that the next file is given the
+// following index, or otherwise releases its name and index for the next
+// file, so that the indices of the copied files have no gaps.
+func (fs *FSWalker) commitRename(rel string, copied bool) {
+	fs.flatMu.Lock()
+	defer fs.flatMu.Unlock()
+
+	if copied {
+		fs.nRenamed++
+		return
+	}
+	delete(fs.renamed, rel)
+}
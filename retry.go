@@ -0,0 +1,61 @@
+package urfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultCopyBackoff is the default amount of time to wait before the first
+// retry of a failed copy; the wait doubles after every retry.
+const DefaultCopyBackoff = 100 * time.Millisecond
+
+// Internal helper function that calls fn, retrying it up to CopyRetries
+// times with exponential backoff if it fails with a transient error. The
+// last error is returned if all retries fail, and permanent errors such as
+// a missing file or denied permissions are returned without retrying.
+func (fs *FSWalker) retry(ctx context.Context, fn func() error) error {
+	backoff := fs.CopyBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= fs.CopyRetries || !isRetryable(err) {
+			return err
+		}
+
+		fs.logf("retrying in %s after error: %s", backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// Internal helper function that returns true if the error is a transient IO
+// or timeout error that may succeed if the operation is retried.
+func isRetryable(err error) bool {
+	if os.IsNotExist(err) || os.IsPermission(err) || os.IsExist(err) {
+		return false
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.EIO, syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ETIMEDOUT:
+			return true
+		}
+		return false
+	}
+
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) {
+		return timeout.Timeout()
+	}
+	return false
+}
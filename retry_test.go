@@ -0,0 +1,89 @@
+package urfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Writer that fails with the error for the specified number of writes.
+type failingWriter struct {
+	failures int
+	err      error
+	writes   int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes <= w.failures {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+func TestRetry(t *testing.T) {
+	eio := &os.PathError{Op: "write", Path: "dst", Err: syscall.EIO}
+	enoent := &os.PathError{Op: "open", Path: "src", Err: syscall.ENOENT}
+
+	tests := []struct {
+		retries  int
+		failures int
+		err      error
+		writes   int
+		failed   bool
+	}{
+		{0, 0, eio, 1, false},
+		{0, 1, eio, 1, true},
+		{3, 2, eio, 3, false},
+		{3, 3, eio, 4, false},
+		{3, 4, eio, 4, true},
+		{3, 1, enoent, 1, true},
+	}
+
+	for i, tc := range tests {
+		fs := makeWalker()
+		fs.CopyRetries = tc.retries
+		fs.CopyBackoff = time.Millisecond
+
+		w := &failingWriter{failures: tc.failures, err: tc.err}
+		err := fs.retry(context.Background(), func() error {
+			_, err := io.Copy(w, strings.NewReader("contents"))
+			return err
+		})
+
+		if (err != nil) != tc.failed {
+			t.Errorf("test %d: expected failed to be %t, got %v", i, tc.failed, err)
+		}
+
+		if w.writes != tc.writes {
+			t.Errorf("test %d: expected %d writes, got %d", i, tc.writes, w.writes)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&os.PathError{Op: "write", Path: "dst", Err: syscall.EIO}, true},
+		{&os.PathError{Op: "write", Path: "dst", Err: syscall.ETIMEDOUT}, true},
+		{&os.PathError{Op: "open", Path: "src", Err: syscall.ENOENT}, false},
+		{&os.PathError{Op: "open", Path: "src", Err: syscall.EACCES}, false},
+		{os.ErrNotExist, false},
+		{errors.New("unknown"), false},
+		{context.Canceled, false},
+	}
+
+	for _, tc := range tests {
+		if retryable := isRetryable(tc.err); retryable != tc.expected {
+			t.Errorf("expected retryable %t for %v, got %t", tc.expected, tc.err, retryable)
+		}
+	}
+}
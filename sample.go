@@ -1,40 +1,80 @@
 package urfs
 
 import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"math/rand"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 // Sample the files contained in a source directory (src), copying them to a
 // destination directory (dst) with some probability between 0 and 1 (size).
-// To modify the behavior of the walk, pass in a FSWalker; if nil will use
-// the default FSWalker.
+// Returns a summary of how many files were sampled; use SampleFiles to get
+// the structured result including the list of copied files. If the walk
+// times out or is canceled, the summary of the files copied so far is
+// returned along with the context error.
+//
+// If the walker's Seed is set, two runs with the same seed on the same
+// directory contents produce the same sample, regardless of the order in
+// which the concurrent workers process the paths.
 func (fs *FSWalker) Sample(src, dst string, size float64) (string, error) {
+	result, err := fs.SampleFiles(src, dst, size)
+	if result == nil {
+		return "", err
+	}
+	return result.String(), err
+}
+
+// SampleFiles samples the files in the source directory (src), copying them
+// to the destination directory (dst) with some probability between 0 and 1
+// (size) as Sample does, returning the structured result of the sample. If
+// the walk times out or is canceled, the partial result of the files copied
+// so far is returned along with the context error.
+func (fs *FSWalker) SampleFiles(src, dst string, size float64) (*SampleResult, error) {
+	var mu sync.Mutex
+	salt := fs.salt()
+	copied := make([]string, 0)
+	selected := make([]sampleItem, 0)
+
 	// Run the walk with our sampling function
 	err := fs.Walk(src, func(path string) (string, error) {
-		// If we're in the sample percent, perform the copy
-		if rand.Float64() <= size {
-			// Get the relative path from the base
-			rel, err := filepath.Rel(src, path)
-			if err != nil {
-				return "", err
-			}
-
-			// Create the new path to the destination
-			drl := filepath.Join(dst, rel)
+		// Get the relative path from the base
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
 
-			// Create the directory if it doesn't exist
-			if err = Mkdir(filepath.Dir(drl)); err != nil {
-				return "", err
+		// If we're in the sample percent, perform the copy; renamed files
+		// are copied once the walk is complete so that they are numbered in
+		// order of their paths.
+		if sampleKey(salt, rel) <= size {
+			if fs.Rename != nil {
+				mu.Lock()
+				selected = append(selected, sampleItem{rel: rel, path: path})
+				mu.Unlock()
+				return path, nil
 			}
 
-			// Copy the file to the destination directory
-			if err = CopyFile(drl, path, 0644); err != nil {
+			drl, err := fs.copySample(fs.ctx, dst, rel, path)
+			if err != nil || drl == "" {
 				return "", err
 			}
 
-			// Return the path to the copied file
+			mu.Lock()
+			copied = append(copied, drl)
+			mu.Unlock()
 			return drl, nil
 		}
 
@@ -42,13 +82,718 @@ func (fs *FSWalker) Sample(src, dst string, size float64) (string, error) {
 		return "", nil
 	})
 
+	// The walk is canceled once the byte budget is spent, which completes it
+	if err == context.Canceled && fs.budgetSpent() {
+		err = nil
+	}
+
+	// If an error occured return it, along with the partial result if the
+	// sample was interrupted by the context.
+	if err != nil {
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			mu.Lock()
+			defer mu.Unlock()
+			return fs.newSampleResult(copied, fs.duration), err
+		}
+		return nil, err
+	}
+
+	// Copy the renamed files in order; the context of the walk is done so
+	// the copies are checked against the parent context.
+	sortItems(selected)
+	for _, item := range selected {
+		drl, err := fs.copySample(fs.parent, dst, item.rel, item.path)
+		if err != nil {
+			return nil, err
+		}
+
+		if drl != "" {
+			copied = append(copied, drl)
+		}
+	}
+
+	// Otherwise return the result of the sample
+	return fs.newSampleResult(copied, fs.duration), nil
+}
+
+// SampleN copies exactly n files chosen uniformly at random from the source
+// directory (src) to the destination directory (dst). Because the number of
+// files is not known in advance, reservoir sampling is used to select the
+// files in a single pass of the walk, then the selected files are copied.
+// If n is greater than the number of files found, all files are copied.
+//
+// Each file is assigned a random key and the n files with the smallest keys
+// are kept in the reservoir, so the sample is reproducible if Seed is set.
+func (fs *FSWalker) SampleN(src, dst string, n int) (string, error) {
+	return fs.sampleN(src, dst, n, false)
+}
+
+// SampleWeighted copies n files chosen at random from the source directory
+// (src) to the destination directory (dst) as SampleN does, but weights the
+// selection of each file by its size, so that larger files are more likely
+// to be selected and the sample is representative of the bytes in src
+// rather than of the files. Empty files are only selected if there are
+// fewer than n files that are not empty.
+//
+// The files are selected in a single pass of the walk with the A-Res
+// weighted reservoir sampling algorithm of Efraimidis and Spirakis: each
+// file is assigned the key u^(1/w) for a uniform random u and its size w,
+// and the n files with the largest keys are selected. This is equivalent to
+// drawing files one at a time without replacement with probability
+// proportional to their size. The sample is reproducible if Seed is set.
+func (fs *FSWalker) SampleWeighted(src, dst string, n int) (string, error) {
+	return fs.sampleN(src, dst, n, true)
+}
+
+// Internal helper function that selects n files from src with reservoir
+// sampling, weighting the files by size if required, then copies the
+// selected files to dst and returns the summary of the sample.
+func (fs *FSWalker) sampleN(src, dst string, n int, weighted bool) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("sample count must be greater than zero")
+	}
+
+	// The reservoir of selected paths, a max-heap on the sample key
+	var (
+		mu        sync.Mutex
+		seen      int
+		salt      = fs.salt()
+		reservoir = make(sampleHeap, 0, n)
+	)
+
+	// Run the walk with the reservoir sampling function
+	err := fs.Walk(src, func(path string) (string, error) {
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
+
+		item := sampleItem{key: sampleKey(salt, rel), rel: rel, path: path}
+		if weighted {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			item.key = weightedKey(item.key, info.Size())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen++
+		if len(reservoir) < n {
+			heap.Push(&reservoir, item)
+		} else if item.key < reservoir[0].key {
+			reservoir[0] = item
+			heap.Fix(&reservoir, 0)
+		}
+
+		return path, nil
+	})
+
 	// If an error occured return it
 	if err != nil {
 		return "", err
 	}
 
-	// Otherwise return a statement of how much was sampled
-	pcent := (float64(fs.nResults) / float64(fs.nPaths)) * 100.0
-	result := fmt.Sprintf("sampled %d of %d files (%0.1f%%) in %s", fs.nResults, fs.nPaths, pcent, fs.duration)
+	// Copy all of the selected files to the destination in order of their
+	// paths; the context of the walk is done so the copies are checked
+	// against the parent context.
+	selected := []sampleItem(reservoir)
+	sortItems(selected)
+
+	copied := make([]string, 0, len(reservoir))
+	for _, item := range selected {
+		drl, err := fs.copySample(fs.parent, dst, item.rel, item.path)
+		if err != nil {
+			return "", err
+		}
+
+		if drl != "" {
+			copied = append(copied, drl)
+		}
+	}
+
+	// Return a statement of how much was sampled
+	result := fs.newSampleResult(copied, time.Since(fs.started)).String()
+	if weighted {
+		result += " (size-weighted)"
+	}
+
+	// Distinguish a source with fewer files than requested from selected
+	// files that were skipped, e.g. by a unique sample or the byte budget.
+	skipped := len(reservoir) - len(copied)
+	if seen < n {
+		if skipped == 0 {
+			result += fmt.Sprintf(" (requested %d, copied all files)", n)
+		} else {
+			result += fmt.Sprintf(" (requested %d, found only %d files)", n, seen)
+		}
+	}
+
+	if skipped > 0 {
+		result += fmt.Sprintf(" (%d of %d selected files skipped)", skipped, len(reservoir))
+	}
 	return result, nil
 }
+
+// SampleStratified copies a fraction (size) of the files in each immediate
+// subdirectory of the source directory (src) to the destination directory
+// (dst), so that small subdirectories are represented in the same proportion
+// as large ones. Files directly in src are sampled as their own stratum. If
+// the fraction selects no files from a non-empty stratum, the file with the
+// smallest sample key is copied so that every stratum contributes at least
+// one file. Returns a summary of the sample followed by the number of files
+// sampled from each stratum.
+//
+// Unlike Sample, which copies files as they are discovered in a single pass,
+// the files must first be grouped by stratum during the walk and are then
+// sampled and copied in a second pass, so the paths of all the files in src
+// are kept in memory and no files are copied until the walk is complete.
+func (fs *FSWalker) SampleStratified(src, dst string, size float64) (string, error) {
+	var (
+		mu     sync.Mutex
+		salt   = fs.salt()
+		strata = make(map[string][]sampleItem)
+	)
+
+	// Group the files by the top-level subdirectory of src they're in
+	err := fs.Walk(src, func(path string) (string, error) {
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return "", err
+		}
+
+		name := "."
+		if parts := strings.SplitN(filepath.ToSlash(rel), "/", 2); len(parts) > 1 {
+			name = parts[0]
+		}
+
+		mu.Lock()
+		strata[name] = append(strata[name], sampleItem{key: sampleKey(salt, rel), rel: rel, path: path})
+		mu.Unlock()
+		return path, nil
+	})
+
+	// If an error occured return it
+	if err != nil {
+		return "", err
+	}
+
+	// Sample each stratum independently in the order of their names
+	names := make([]string, 0, len(strata))
+	for name := range strata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	copied := make([]string, 0)
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		items := strata[name]
+		selected := make([]sampleItem, 0)
+		smallest := items[0]
+		for _, item := range items {
+			if item.key <= size {
+				selected = append(selected, item)
+			}
+
+			if item.key < smallest.key {
+				smallest = item
+			}
+		}
+
+		// Ensure every stratum contributes at least one file
+		if len(selected) == 0 && size > 0 {
+			selected = append(selected, smallest)
+		}
+
+		// The context of the walk is done so the copies are checked against
+		// the parent context.
+		sortItems(selected)
+		for _, item := range selected {
+			drl, err := fs.copySample(fs.parent, dst, item.rel, item.path)
+			if err != nil {
+				return "", err
+			}
+
+			if drl != "" {
+				copied = append(copied, drl)
+			}
+		}
+
+		counts = append(counts, fmt.Sprintf("  %s: sampled %d of %d files", name, len(selected), len(items)))
+	}
+
+	// Return a statement of how much was sampled from each stratum
+	result := fs.newSampleResult(copied, time.Since(fs.started)).String()
+	return result + "\n" + strings.Join(counts, "\n"), nil
+}
+
+// SampleResult describes the files copied by a sample.
+type SampleResult struct {
+	Copied      []string      // paths to the copied files in the destination
+	NumSampled  uint64        // number of files sampled
+	NumTotal    uint64        // number of files discovered in the source
+	Percent     float64       // percent of the discovered files that were sampled
+	Duration    time.Duration // amount of time it took to complete the sample
+	DryRun      bool          // if the files were selected but not copied
+	Sync        bool          // if unchanged files in the destination were skipped
+	NumSkipped  uint64        // number of sampled files that were unchanged in the destination
+	NumExisting uint64        // number of sampled files not overwritten in the destination
+	Unique      bool          // if sampled files with duplicate contents were skipped
+	NumDupes    uint64        // number of sampled files skipped as duplicates
+	NumResumed  uint64        // number of sampled files skipped since a previous run copied them
+	NumBytes    int64         // number of bytes in the copied files
+	MaxBytes    int64         // maximum number of bytes to copy (0 for no limit)
+	BudgetSpent bool          // if the sample stopped because the next file exceeded MaxBytes
+}
+
+// Internal helper function to create a sample result from the copied files
+// and the number of paths discovered by the last walk.
+func (fs *FSWalker) newSampleResult(copied []string, duration time.Duration) *SampleResult {
+	result := &SampleResult{
+		Copied:      copied,
+		NumSampled:  uint64(len(copied)),
+		NumTotal:    fs.nPaths,
+		Duration:    duration,
+		DryRun:      fs.DryRun,
+		Sync:        fs.Sync,
+		NumSkipped:  atomic.LoadUint64(&fs.nSkipped),
+		NumExisting: atomic.LoadUint64(&fs.nExisting),
+		Unique:      fs.Unique,
+		NumDupes:    atomic.LoadUint64(&fs.nDupes),
+		NumResumed:  atomic.LoadUint64(&fs.nResumed),
+		NumBytes:    atomic.LoadInt64(&fs.nBytes),
+		MaxBytes:    fs.MaxBytes,
+		BudgetSpent: fs.budgetSpent(),
+	}
+
+	if result.NumTotal > 0 {
+		result.Percent = (float64(result.NumSampled) / float64(result.NumTotal)) * 100.0
+	}
+	return result
+}
+
+// String returns a summary of how much was sampled.
+func (r *SampleResult) String() string {
+	summary := fmt.Sprintf(
+		"sampled %d of %d files (%0.1f%%) in %s",
+		r.NumSampled, r.NumTotal, r.Percent, r.Duration,
+	)
+
+	if files, bytes := r.Throughput(); files > 0 {
+		summary += fmt.Sprintf(" (%0.1f files/s, %s/s)", files, HumanizeBytes(uint64(bytes)))
+	}
+
+	if r.Sync {
+		summary += fmt.Sprintf(" (%d copied, %d unchanged)", r.NumSampled-r.NumSkipped-r.NumExisting, r.NumSkipped)
+	}
+
+	if r.NumExisting > 0 {
+		summary += fmt.Sprintf(" (%d already existed and were not overwritten)", r.NumExisting)
+	}
+
+	if r.Unique {
+		summary += fmt.Sprintf(" (%d unique, %d duplicates not copied)", r.NumSampled, r.NumDupes)
+	}
+
+	if r.NumResumed > 0 {
+		summary += fmt.Sprintf(" (%d already copied by a previous run)", r.NumResumed)
+	}
+
+	if r.BudgetSpent {
+		summary += fmt.Sprintf(
+			" (stopped after %s of the %s budget)",
+			HumanizeBytes(uint64(r.NumBytes)), HumanizeBytes(uint64(r.MaxBytes)),
+		)
+	}
+
+	if r.DryRun {
+		summary = "dry run: " + summary + " (no files copied)"
+	}
+	return summary
+}
+
+// Throughput returns the number of files and bytes sampled per second, or
+// zeros if the duration of the sample is unknown.
+func (r *SampleResult) Throughput() (filesPerSec, bytesPerSec float64) {
+	return throughput(r.NumSampled, uint64(r.NumBytes), r.Duration)
+}
+
+// Internal helper function that copies the path to the relative path (rel)
+// in the dst directory, creating any intermediate directories as needed and
+// preserving the file metadata if required. Returns the path to the copied
+// file, or the path it would be copied to if this is a dry run; if the
+// contents of the file have already been copied by a unique sample, an empty
+// path is returned, as it is if the file was copied by a previous run
+// recorded in the sample state, or if the MaxBytes budget has been spent.
+// The copy is aborted if the context is canceled.
+func (fs *FSWalker) copySample(ctx context.Context, dst, rel, path string) (drl string, err error) {
+	// Stop selecting files once the byte budget has been spent
+	if fs.budgetSpent() {
+		return "", nil
+	}
+
+	// Skip files that were copied by a previous run of the sample
+	if fs.State != nil && fs.State.Done(path) {
+		atomic.AddUint64(&fs.nResumed, 1)
+		return "", nil
+	}
+
+	// Skip files whose contents have already been copied if required
+	var digest string
+	if fs.Unique {
+		if digest, err = hashFile(path, sha256.New()); err != nil {
+			return "", err
+		}
+
+		if !fs.see(digest) {
+			atomic.AddUint64(&fs.nDupes, 1)
+			return "", nil
+		}
+	}
+
+	// A file sampled from a single file source is copied to its base name
+	if rel == "." {
+		rel = filepath.Base(path)
+	}
+
+	// Mirror the full source path under dst rather than the relative path
+	if fs.PreservePath {
+		if rel, err = rootRel(path); err != nil {
+			return "", err
+		}
+	}
+
+	// Name the file with the rename template if required, only using up its
+	// index and name once the file has been copied (or already exists).
+	if fs.Rename != nil {
+		if rel, err = fs.rename(rel, path, digest); err != nil {
+			return "", err
+		}
+
+		named := rel
+		defer func() {
+			fs.commitRename(named, err == nil && drl != "")
+		}()
+	}
+
+	// Compressed files are given the gzip extension
+	if fs.Gzip {
+		rel += ".gz"
+	}
+
+	// Create the new path to the destination
+	drl = filepath.Join(dst, rel)
+	if fs.Flatten {
+		drl = fs.flatPath(dst, rel)
+	}
+
+	// Skip files that already exist in the destination if not overwriting
+	if !fs.Overwrite && PathExists(drl) {
+		atomic.AddUint64(&fs.nExisting, 1)
+		return drl, nil
+	}
+
+	// Skip files that are unchanged in the destination when syncing
+	if fs.Sync {
+		changed, err := needsCopy(drl, path)
+		if err != nil {
+			return "", err
+		}
+
+		if !changed {
+			atomic.AddUint64(&fs.nSkipped, 1)
+			return drl, nil
+		}
+	}
+
+	// Reserve the bytes of the file, stopping the sample if the file does
+	// not fit in the remaining budget.
+	size, err := fs.reserve(path)
+	if err != nil || size < 0 {
+		return "", err
+	}
+
+	// Do not modify the destination on a dry run
+	if fs.DryRun {
+		return drl, nil
+	}
+
+	// Create the directory if it doesn't exist
+	if err := Mkdir(filepath.Dir(drl)); err != nil {
+		fs.release(size)
+		return "", err
+	}
+
+	// Copy the file to the destination directory, retrying transient errors
+	progress := fs.copyProgress(path)
+	err = fs.retry(ctx, func() error {
+		if fs.Gzip {
+			return fs.copyGzip(ctx, drl, path, progress)
+		}
+
+		if fs.Preserve || fs.Sync {
+			return copyFileMeta(ctx, drl, path, fs.limiter, progress)
+		}
+		return copyFile(ctx, drl, path, 0644, fs.limiter, progress)
+	})
+
+	if err != nil {
+		// Allow a duplicate of the file to be copied in its place
+		if digest != "" {
+			fs.unsee(digest)
+		}
+		fs.release(size)
+		return "", err
+	}
+
+	// Record the copy in the manifest
+	if fs.Manifest != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fs.Manifest.Add(path, drl, info.Size())
+	}
+
+	// Record the copy in the state so it is not copied again when resuming
+	if fs.State != nil {
+		if err := fs.State.Add(path); err != nil {
+			return "", err
+		}
+	}
+
+	// Return the path to the copied file
+	return drl, nil
+}
+
+// Internal helper function that adds the size of the file at path to the
+// bytes copied by the sample, returning the number of bytes reserved. If
+// MaxBytes is set and the file does not fit in the remaining budget, the
+// budget is marked as spent and the walk is canceled so that no more files
+// are selected, and -1 is returned. Reserving the bytes before the copy
+// ensures that the concurrent copies never exceed the budget; copies that
+// are in flight when the walk is canceled are abandoned and their bytes
+// released.
+func (fs *FSWalker) reserve(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	if total := atomic.AddInt64(&fs.nBytes, size); fs.MaxBytes <= 0 || total <= fs.MaxBytes {
+		return size, nil
+	}
+
+	atomic.AddInt64(&fs.nBytes, -size)
+	if atomic.CompareAndSwapUint32(&fs.spent, 0, 1) {
+		fs.logf("stopping sample: %s (%s) does not fit in the remaining budget", path, HumanizeBytes(uint64(size)))
+	}
+	fs.Cancel()
+	return -1, nil
+}
+
+// Internal helper function that releases the bytes reserved for a file that
+// could not be copied.
+func (fs *FSWalker) release(size int64) {
+	if size > 0 {
+		atomic.AddInt64(&fs.nBytes, -size)
+	}
+}
+
+// Internal helper function that returns true if the sample stopped because
+// a file did not fit in the MaxBytes budget.
+func (fs *FSWalker) budgetSpent() bool {
+	return atomic.LoadUint32(&fs.spent) == 1
+}
+
+// Internal helper function that records the digest of the contents of a file
+// copied by a unique sample, returning false if it has already been seen.
+func (fs *FSWalker) see(digest string) bool {
+	fs.digestsMu.Lock()
+	defer fs.digestsMu.Unlock()
+
+	if fs.digests[digest] {
+		return false
+	}
+	fs.digests[digest] = true
+	return true
+}
+
+// Internal helper function that forgets the digest of a file that could not
+// be copied by a unique sample.
+func (fs *FSWalker) unsee(digest string) {
+	fs.digestsMu.Lock()
+	defer fs.digestsMu.Unlock()
+	delete(fs.digests, digest)
+}
+
+// Internal helper function that returns the progress func that reports the
+// progress of copying the file at path to OnCopy, or nil if it is not set.
+func (fs *FSWalker) copyProgress(path string) CopyProgressFunc {
+	if fs.OnCopy == nil {
+		return nil
+	}
+
+	return func(copied, total int64) {
+		fs.OnCopy(path, copied, total)
+	}
+}
+
+// Internal helper function that returns true if the file at src needs to be
+// copied to dst, e.g. if dst does not exist or if its size or modification
+// time differs from the size or modification time of src.
+func needsCopy(dst, src string) (bool, error) {
+	dinfo, err := os.Stat(dst)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	sinfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+
+	return dinfo.Size() != sinfo.Size() || !dinfo.ModTime().Equal(sinfo.ModTime()), nil
+}
+
+// Internal helper function that compresses the file at path to drl,
+// preserving the file metadata if required.
+func (fs *FSWalker) copyGzip(ctx context.Context, drl, path string, progress CopyProgressFunc) error {
+	if !fs.Preserve {
+		return copyFileGzip(ctx, drl, path, 0644, fs.limiter, progress)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err = copyFileGzip(ctx, drl, path, info.Mode().Perm(), fs.limiter, progress); err != nil {
+		return err
+	}
+	return os.Chtimes(drl, atime(info), info.ModTime())
+}
+
+// Internal helper function that returns the path in dst to copy the file at
+// the relative path (rel) to when flattening the directory structure. The
+// file is copied to its base name unless another file in the sample or in
+// dst already has that name, in which case the first 8 hex characters of the
+// FNV hash of the relative path are appended to the name before the
+// extension, e.g. "photo-1a2b3c4d.jpg".
+func (fs *FSWalker) flatPath(dst, rel string) string {
+	fs.flatMu.Lock()
+	defer fs.flatMu.Unlock()
+
+	name := filepath.Base(rel)
+	if fs.flatNames[name] || PathExists(filepath.Join(dst, name)) {
+		h := fnv.New32a()
+		h.Write([]byte(rel))
+
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s-%08x%s", strings.TrimSuffix(name, ext), h.Sum32(), ext)
+	}
+
+	fs.flatNames[name] = true
+	return filepath.Join(dst, name)
+}
+
+// Internal helper function that returns the absolute path relative to the
+// root of the file system so that it can be joined to dst, e.g.
+// "/var/log/app.log" becomes "var/log/app.log". On Windows the volume name
+// becomes the first directory, e.g. "C:\logs\app.log" becomes
+// "C\logs\app.log" and "\\server\share\app.log" becomes
+// "server\share\app.log".
+func rootRel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	seps := string(filepath.Separator) + "/"
+	vol := filepath.VolumeName(abs)
+	rest := strings.TrimLeft(abs[len(vol):], seps)
+	vol = strings.Trim(strings.TrimSuffix(vol, ":"), seps)
+	return filepath.Join(vol, rest), nil
+}
+
+//===========================================================================
+// Random Selection
+//===========================================================================
+
+// Internal helper that returns a random salt for a sampling walk. If the Seed
+// is set, a dedicated random source is used so that the salt is reproducible
+// and unaffected by any other use of the global source.
+func (fs *FSWalker) salt() uint64 {
+	if fs.Seed != 0 {
+		return uint64(rand.New(rand.NewSource(fs.Seed)).Int63())
+	}
+	return uint64(rand.Int63())
+}
+
+// Internal helper that computes a uniform random key in [0, 1) for the
+// relative path from the salt. Because the key depends only on the salt and
+// the path, the selection is independent of the order paths are processed.
+func sampleKey(salt uint64, rel string) float64 {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, salt)
+
+	h := fnv.New64a()
+	h.Write(buf)
+	h.Write([]byte(rel))
+
+	// Finalize the hash with the splitmix64 mixer to spread similar paths.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x = x ^ (x >> 31)
+
+	return float64(x>>11) / float64(1<<53)
+}
+
+// Internal helper that converts the uniform key u of a file into its key for
+// A-Res weighted sampling with the weight w. Rather than selecting the files
+// with the largest v^(1/w) for v = 1-u, which is also uniform, the files with
+// the smallest -ln(v)/w are selected; the order is the same, so the reservoir
+// remains a max-heap of the smallest keys as for the uniform keys. Files with
+// no weight have an infinite key.
+func weightedKey(u float64, w int64) float64 {
+	if w <= 0 {
+		return math.Inf(1)
+	}
+	return -math.Log1p(-u) / float64(w)
+}
+
+// Internal type for a path selected by reservoir sampling.
+type sampleItem struct {
+	key  float64 // random key used to select the path
+	rel  string  // path relative to the sample source
+	path string  // complete path to the file
+}
+
+// Internal helper function that sorts the items by their relative paths, so
+// that the selected files are copied, and renamed files numbered, in the
+// same order regardless of the order in which the workers found them.
+func sortItems(items []sampleItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].rel < items[j].rel })
+}
+
+// Internal max-heap of sample items ordered by key, implements heap.Interface.
+type sampleHeap []sampleItem
+
+func (h sampleHeap) Len() int            { return len(h) }
+func (h sampleHeap) Less(i, j int) bool  { return h[i].key > h[j].key }
+func (h sampleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sampleHeap) Push(x interface{}) { *h = append(*h, x.(sampleItem)) }
+func (h *sampleHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
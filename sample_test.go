@@ -0,0 +1,1106 @@
+package urfs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Helper function that creates a tree of n small files for sampling.
+func makeSampleTree(t *testing.T, n int) string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		files[filepath.Join(fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%03d.txt", i))] = fmt.Sprintf("%d", i)
+	}
+	return makeTree(t, files)
+}
+
+// Helper function that lists the relative paths of all files under root.
+func listFiles(t *testing.T, root string) []string {
+	files := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return files
+}
+
+func TestSampleN(t *testing.T) {
+	src := makeSampleTree(t, 50)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	if _, err := fs.SampleN(src, dst, 10); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if n := len(listFiles(t, dst)); n != 10 {
+		t.Fatalf("expected 10 files sampled, got %d", n)
+	}
+}
+
+func TestSampleNAll(t *testing.T) {
+	src := makeSampleTree(t, 5)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	result, err := fs.SampleN(src, dst, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if n := len(listFiles(t, dst)); n != 5 {
+		t.Fatalf("expected all 5 files sampled, got %d", n)
+	}
+
+	if !strings.Contains(result, "copied all files") {
+		t.Errorf("expected summary to note all files were copied: %q", result)
+	}
+}
+
+func TestSampleNSkipped(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+		"c.txt": "c",
+		"d.txt": "same",
+		"e.txt": "same",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	// A pre-existing target is not overwritten, but all files were found
+	if err := ioutil.WriteFile(filepath.Join(dst, "a.txt"), []byte("existing"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := makeWalker()
+	fs.Overwrite = false
+	result, err := fs.SampleN(src, dst, 5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Contains(result, "requested") || strings.Contains(result, "skipped") {
+		t.Errorf("expected no note on the number of files requested: %q", result)
+	}
+
+	if !strings.Contains(result, "(1 already existed and were not overwritten)") {
+		t.Errorf("expected the existing file in the summary: %q", result)
+	}
+
+	// Duplicates skipped by a unique sample are not reported as all files
+	fs = makeWalker()
+	fs.Unique = true
+	if result, err = fs.SampleN(src, dst, 10); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Contains(result, "copied all files") {
+		t.Errorf("expected summary not to claim all files were copied: %q", result)
+	}
+
+	for _, note := range []string{"(requested 10, found only 5 files)", "(1 of 5 selected files skipped)"} {
+		if !strings.Contains(result, note) {
+			t.Errorf("expected %q in the summary: %q", note, result)
+		}
+	}
+}
+
+func TestSampleNSeed(t *testing.T) {
+	src := makeSampleTree(t, 50)
+	defer os.RemoveAll(src)
+
+	samples := make([][]string, 2)
+	for i := range samples {
+		dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dst)
+
+		fs := makeWalker()
+		fs.Seed = 42
+		if _, err := fs.SampleN(src, dst, 10); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		samples[i] = listFiles(t, dst)
+		sort.Strings(samples[i])
+	}
+
+	if len(samples[0]) != 10 || len(samples[1]) != 10 {
+		t.Fatalf("expected 10 files in each sample, got %d and %d", len(samples[0]), len(samples[1]))
+	}
+
+	for i := range samples[0] {
+		if samples[0][i] != samples[1][i] {
+			t.Fatalf("seeded samples differ: %v vs %v", samples[0], samples[1])
+		}
+	}
+}
+
+func TestSampleFiles(t *testing.T) {
+	src := makeSampleTree(t, 40)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	result, err := fs.SampleFiles(src, dst, 0.5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumTotal != 40 {
+		t.Errorf("expected 40 total files, got %d", result.NumTotal)
+	}
+
+	if result.NumSampled != uint64(len(result.Copied)) {
+		t.Errorf("sampled %d files but %d copied", result.NumSampled, len(result.Copied))
+	}
+
+	if n := len(listFiles(t, dst)); n != len(result.Copied) {
+		t.Errorf("expected %d files in destination, found %d", len(result.Copied), n)
+	}
+
+	for _, path := range result.Copied {
+		if !PathExists(path) {
+			t.Errorf("copied path %s does not exist", path)
+		}
+	}
+
+	expected := float64(result.NumSampled) / 40.0 * 100.0
+	if result.Percent != expected {
+		t.Errorf("expected %0.1f%% sampled, got %0.1f%%", expected, result.Percent)
+	}
+
+	if !strings.HasPrefix(result.String(), "sampled ") {
+		t.Errorf("unexpected summary %q", result.String())
+	}
+}
+
+func TestSampleDryRun(t *testing.T) {
+	src := makeSampleTree(t, 40)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Seed = 42
+	fs.DryRun = true
+	result, err := fs.SampleFiles(src, dst, 0.5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if n := len(listFiles(t, dst)); n != 0 {
+		t.Errorf("expected no files copied on a dry run, found %d", n)
+	}
+
+	if result.NumSampled == 0 || result.Percent == 0 {
+		t.Errorf("expected the dry run to report the selection, got %d (%0.1f%%)", result.NumSampled, result.Percent)
+	}
+
+	if !strings.HasPrefix(result.String(), "dry run:") {
+		t.Errorf("expected summary to indicate a dry run: %q", result.String())
+	}
+
+	// the same seed without a dry run should copy the same files
+	fs = makeWalker()
+	fs.Seed = 42
+	actual, err := fs.SampleFiles(src, dst, 0.5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if actual.NumSampled != result.NumSampled {
+		t.Errorf("dry run selected %d files but sample copied %d", result.NumSampled, actual.NumSampled)
+	}
+}
+
+func TestSampleFlatten(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a/photo.jpg": "a",
+		"b/photo.jpg": "b",
+		"c/photo.jpg": "c",
+		"c/other.jpg": "d",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Flatten = true
+	if _, err := fs.Sample(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	files := listFiles(t, dst)
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files in destination, got %v", files)
+	}
+
+	contents := make(map[string]bool)
+	for _, name := range files {
+		if filepath.Dir(name) != "." {
+			t.Errorf("file %s was not flattened", name)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		contents[string(data)] = true
+	}
+
+	if len(contents) != 4 {
+		t.Errorf("expected all 4 files to survive flattening, got contents %v", contents)
+	}
+}
+
+func TestSampleGzip(t *testing.T) {
+	src := makeSampleTree(t, 10)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Gzip = true
+	if _, err := fs.Sample(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	files := listFiles(t, dst)
+	if len(files) != 10 {
+		t.Fatalf("expected 10 files sampled, got %d", len(files))
+	}
+
+	for _, rel := range files {
+		if !strings.HasSuffix(rel, ".gz") {
+			t.Errorf("expected %s to have a .gz extension", rel)
+		}
+
+		if !PathExists(filepath.Join(src, strings.TrimSuffix(rel, ".gz"))) {
+			t.Errorf("compressed file %s does not map to a source file", rel)
+		}
+	}
+}
+
+func TestSampleManifest(t *testing.T) {
+	src := makeSampleTree(t, 20)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	path := filepath.Join(dst, "manifest.csv")
+	manifest, err := NewManifest(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := makeWalker()
+	fs.Manifest = manifest
+
+	result, err := fs.SampleFiles(src, filepath.Join(dst, "sample"), 0.5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := manifest.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if manifest.Count != result.NumSampled {
+		t.Errorf("expected %d rows in manifest, got %d", result.NumSampled, manifest.Count)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(rows) != len(result.Copied)+1 {
+		t.Fatalf("expected %d rows including header, got %d", len(result.Copied)+1, len(rows))
+	}
+
+	if strings.Join(rows[0], ",") != "source,destination,bytes" {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+
+	for _, row := range rows[1:] {
+		info, err := os.Stat(row[0])
+		if err != nil {
+			t.Errorf("could not stat source %s: %s", row[0], err)
+			continue
+		}
+
+		if !PathExists(row[1]) {
+			t.Errorf("destination %s does not exist", row[1])
+		}
+
+		if row[2] != strconv.FormatInt(info.Size(), 10) {
+			t.Errorf("expected %d bytes for %s, got %s", info.Size(), row[0], row[2])
+		}
+	}
+}
+
+func TestSampleSync(t *testing.T) {
+	src := makeSampleTree(t, 10)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Sync = true
+
+	// the first sync copies all of the files
+	result, err := fs.SampleFiles(src, dst, 1.0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 10 || result.NumSkipped != 0 {
+		t.Errorf("expected all files copied, got %d sampled %d skipped", result.NumSampled, result.NumSkipped)
+	}
+
+	// the second sync skips all of the unchanged files
+	if result, err = fs.SampleFiles(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 10 || result.NumSkipped != 10 {
+		t.Errorf("expected all files skipped, got %d sampled %d skipped", result.NumSampled, result.NumSkipped)
+	}
+
+	if !strings.HasSuffix(result.String(), "(0 copied, 10 unchanged)") {
+		t.Errorf("expected summary to report unchanged files: %q", result.String())
+	}
+
+	// a modified file is copied again
+	modified := filepath.Join(src, "dir0", "file000.txt")
+	if err := ioutil.WriteFile(modified, []byte("modified"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result, err = fs.SampleFiles(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSkipped != 9 {
+		t.Errorf("expected 9 files skipped, got %d", result.NumSkipped)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "dir0", "file000.txt"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != "modified" {
+		t.Errorf("expected modified file to be copied, got %q", data)
+	}
+}
+
+func TestSampleStratified(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"root.txt":    "root",
+		"big/a.txt":   "a",
+		"big/b.txt":   "b",
+		"big/c.txt":   "c",
+		"big/d.txt":   "d",
+		"big/e/f.txt": "f",
+		"small/g.txt": "g",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	// A tiny fraction still samples at least one file from every stratum
+	fs := makeWalker()
+	fs.Seed = 42
+	result, err := fs.SampleStratified(src, dst, 0.0001)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	strata := make(map[string]int)
+	for _, path := range listFiles(t, dst) {
+		if dir := filepath.Dir(path); dir == "." {
+			strata["."]++
+		} else {
+			strata[strings.Split(filepath.ToSlash(dir), "/")[0]]++
+		}
+	}
+
+	for _, name := range []string{".", "big", "small"} {
+		if strata[name] != 1 {
+			t.Errorf("expected 1 file sampled from stratum %q, got %d", name, strata[name])
+		}
+	}
+
+	for _, line := range []string{"  .: sampled 1 of 1 files", "  big: sampled 1 of 5 files", "  small: sampled 1 of 1 files"} {
+		if !strings.Contains(result, line) {
+			t.Errorf("expected %q in result %q", line, result)
+		}
+	}
+
+	// Sampling all of the files copies every file
+	dst2, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst2)
+
+	fs = makeWalker()
+	if _, err := fs.SampleStratified(src, dst2, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if n := len(listFiles(t, dst2)); n != 7 {
+		t.Errorf("expected all 7 files sampled, got %d", n)
+	}
+}
+
+func TestSampleTimeout(t *testing.T) {
+	src := makeSampleTree(t, 50)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Limit the rate so that the sample cannot finish before the timeout
+	fs := new(FSWalker)
+	fs.Init(ctx)
+	fs.Workers = 1
+	fs.RateLimit = 10
+	defer fs.Close()
+
+	result, err := fs.Sample(src, dst, 1.0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if !strings.HasPrefix(result, "sampled ") {
+		t.Errorf("expected partial summary with the timeout, got %q", result)
+	}
+
+	copied := len(listFiles(t, dst))
+	if copied >= 50 {
+		t.Errorf("expected the sample to be interrupted, but copied %d files", copied)
+	}
+
+	if !strings.Contains(result, fmt.Sprintf("sampled %d of ", copied)) {
+		t.Errorf("expected summary to report %d files copied, got %q", copied, result)
+	}
+}
+
+func TestSampleSingleFile(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt": "hello",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	result, err := fs.SampleFiles(filepath.Join(src, "a.txt"), dst, 1.0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 1 || result.NumTotal != 1 {
+		t.Errorf("expected 1 of 1 files sampled, got %d of %d", result.NumSampled, result.NumTotal)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != "hello" {
+		t.Errorf("expected the file to be copied into dst, got %q", data)
+	}
+}
+
+func TestSampleOverwrite(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt":     "new a",
+		"sub/b.txt": "new b",
+		"c.txt":     "new c",
+	})
+	defer os.RemoveAll(src)
+
+	tests := []struct {
+		overwrite bool
+		expected  string
+		existing  uint64
+	}{
+		{true, "new a", 0},
+		{false, "old a", 2},
+	}
+
+	for _, tc := range tests {
+		dst := makeTree(t, map[string]string{
+			"a.txt":     "old a",
+			"sub/b.txt": "old b",
+		})
+		defer os.RemoveAll(dst)
+
+		fs := makeWalker()
+		fs.Overwrite = tc.overwrite
+		result, err := fs.SampleFiles(src, dst, 1.0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if result.NumSampled != 3 || result.NumExisting != tc.existing {
+			t.Errorf("overwrite %t: expected 3 sampled and %d existing, got %d and %d", tc.overwrite, tc.existing, result.NumSampled, result.NumExisting)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if string(data) != tc.expected {
+			t.Errorf("overwrite %t: expected %q in dst, got %q", tc.overwrite, tc.expected, data)
+		}
+
+		// files that do not exist are always copied
+		if data, err = ioutil.ReadFile(filepath.Join(dst, "c.txt")); err != nil || string(data) != "new c" {
+			t.Errorf("overwrite %t: expected new file to be copied, got %q (%v)", tc.overwrite, data, err)
+		}
+
+		hasExisting := strings.Contains(result.String(), "2 already existed")
+		if hasExisting == tc.overwrite {
+			t.Errorf("overwrite %t: unexpected summary %q", tc.overwrite, result.String())
+		}
+	}
+}
+
+func TestSampleUnique(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt":     "same",
+		"sub/b.txt": "same",
+		"c.txt":     "different",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Unique = true
+	result, err := fs.SampleFiles(src, dst, 1.0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 2 || result.NumDupes != 1 {
+		t.Errorf("expected 2 unique and 1 duplicate, got %d and %d", result.NumSampled, result.NumDupes)
+	}
+
+	// only one of the identical files is copied
+	same := 0
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if PathExists(filepath.Join(dst, name)) {
+			same++
+		}
+	}
+
+	if same != 1 {
+		t.Errorf("expected one of the identical files to be copied, found %d", same)
+	}
+
+	if files := listFiles(t, dst); len(files) != 2 {
+		t.Errorf("expected 2 files in dst, found %v", files)
+	}
+
+	if summary := result.String(); !strings.Contains(summary, "(2 unique, 1 duplicates not copied)") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
+
+func TestSampleState(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"c.txt":     "c",
+	})
+	defer os.RemoveAll(src)
+
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "state.txt")
+	sample := func(dst string) *SampleResult {
+		state, err := OpenSampleState(path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer state.Close()
+
+		fs := makeWalker()
+		fs.State = state
+		result, err := fs.SampleFiles(src, dst, 1.0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+
+	first := sample(filepath.Join(tmpdir, "first"))
+	if first.NumSampled != 3 || first.NumResumed != 0 {
+		t.Errorf("expected 3 copied and 0 resumed, got %d and %d", first.NumSampled, first.NumResumed)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+
+	if paths, err := ReadPaths(f); err != nil || len(paths) != 3 {
+		t.Errorf("expected 3 paths in the state file, got %v (%v)", paths, err)
+	}
+
+	// the second run with the same state file copies nothing new
+	dst := filepath.Join(tmpdir, "second")
+	second := sample(dst)
+	if second.NumSampled != 0 || second.NumResumed != 3 {
+		t.Errorf("expected 0 copied and 3 resumed, got %d and %d", second.NumSampled, second.NumResumed)
+	}
+
+	if PathExists(dst) {
+		t.Errorf("expected no files to be copied, found %v", listFiles(t, dst))
+	}
+}
+
+func TestOpenSampleState(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// paths are loaded exactly as they were written to the state
+	path := filepath.Join(tmpdir, "state.txt")
+	paths := []string{"src/a.txt", " src/b.txt", "src/c.txt ", "#d.txt", "src/#e.txt"}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	state, err := OpenSampleState(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer state.Close()
+
+	if state.Count != uint64(len(paths)) {
+		t.Errorf("expected %d paths loaded, got %d", len(paths), state.Count)
+	}
+
+	for _, p := range paths {
+		if !state.Done(p) {
+			t.Errorf("expected %q to be loaded from the state", p)
+		}
+	}
+
+	if state.Done("src/b.txt") {
+		t.Error("expected paths not to be trimmed")
+	}
+}
+
+func TestSamplePreservePath(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt":         "a",
+		"logs/app.log":  "b",
+		"logs/old/x.gz": "c",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.PreservePath = true
+	result, err := fs.SampleFiles(src, dst, 1.0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 3 {
+		t.Errorf("expected 3 files sampled, got %d", result.NumSampled)
+	}
+
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the files are nested under the full source path in dst
+	base := filepath.Join(dst, strings.TrimPrefix(abs, string(filepath.Separator)))
+	for _, name := range []string{"a.txt", "logs/app.log", "logs/old/x.gz"} {
+		if !PathExists(filepath.Join(base, filepath.FromSlash(name))) {
+			t.Errorf("expected %s to be copied under %s", name, base)
+		}
+	}
+
+	rel, err := rootRel(filepath.Join(src, "a.txt"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if filepath.IsAbs(rel) || !strings.HasSuffix(rel, "a.txt") {
+		t.Errorf("expected a relative path ending in a.txt, got %q", rel)
+	}
+}
+
+func TestSampleRename(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.jpg":     "a",
+		"b.jpg":     "b",
+		"c.png":     "c",
+		"d.jpg":     "d",
+		"sub/e.jpg": "e",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	fs.Flatten = true
+	if fs.Rename, err = RenameTemplate(`img_{{printf "%04d" .Index}}{{.Ext}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := fs.SampleFiles(src, dst, 1.0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.NumSampled != 5 {
+		t.Errorf("expected 5 files sampled, got %d", result.NumSampled)
+	}
+
+	// every file is named by its index without any collisions
+	files := listFiles(t, dst)
+	sort.Strings(files)
+	expected := []string{"img_0001", "img_0002", "img_0003", "img_0004", "img_0005"}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d files in dst, found %v", len(expected), files)
+	}
+
+	for i, file := range files {
+		if name := strings.TrimSuffix(file, filepath.Ext(file)); name != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], file)
+		}
+	}
+
+	// templates that do not produce distinct names are an error
+	fs.Rename, _ = RenameTemplate("same{{.Ext}}")
+	if _, err := fs.SampleFiles(src, dst, 1.0); err == nil {
+		t.Error("expected an error for duplicate names")
+	}
+
+	// bad templates are reported before sampling
+	for _, format := range []string{"{{.Index", "{{.Missing}}"} {
+		if _, err := RenameTemplate(format); err == nil {
+			t.Errorf("expected an error parsing %q", format)
+		}
+	}
+}
+
+func TestSampleRenameOrder(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"d.jpg":     "d",
+		"a.jpg":     "a",
+		"b.jpg":     "a",
+		"c.jpg":     "c",
+		"sub/e.jpg": "e",
+	})
+	defer os.RemoveAll(src)
+
+	// Files are numbered in order of their paths, and the duplicate b.jpg
+	// that is skipped does not use up an index.
+	expected := map[string]string{
+		"img_1.jpg": "a",
+		"img_2.jpg": "c",
+		"img_3.jpg": "d",
+		"img_4.jpg": "e",
+	}
+
+	for i := 0; i < 3; i++ {
+		dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dst)
+
+		fs := makeWalker()
+		fs.Flatten = true
+		fs.Unique = true
+		if fs.Rename, err = RenameTemplate(`img_{{.Index}}{{.Ext}}`); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if _, err := fs.SampleFiles(src, dst, 1.0); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		files := listFiles(t, dst)
+		if len(files) != len(expected) {
+			t.Fatalf("expected %d files in dst, found %v", len(expected), files)
+		}
+
+		for name, contents := range expected {
+			data, err := ioutil.ReadFile(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if string(data) != contents {
+				t.Errorf("expected %s to contain %q, got %q", name, contents, data)
+			}
+		}
+	}
+}
+
+func TestSampleMaxBytes(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("dir%d/file%02d.txt", i%5, i)] = strings.Repeat("x", 100)
+	}
+
+	src := makeTree(t, files)
+	defer os.RemoveAll(src)
+
+	for _, budget := range []int64{550, 1000, 100000} {
+		dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dst)
+
+		fs := makeWalker()
+		fs.MaxBytes = budget
+		result, err := fs.SampleFiles(src, dst, 1.0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		// the copied files never exceed the budget
+		var total int64
+		for _, path := range listFiles(t, dst) {
+			info, err := os.Stat(filepath.Join(dst, path))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			total += info.Size()
+		}
+
+		if total > budget || total != result.NumBytes {
+			t.Errorf("budget %d: copied %d bytes, reported %d", budget, total, result.NumBytes)
+		}
+
+		if budget < 5000 && !result.BudgetSpent {
+			t.Errorf("budget %d: expected the budget to be spent", budget)
+		}
+
+		if budget >= 5000 && (result.BudgetSpent || result.NumSampled != 50) {
+			t.Errorf("budget %d: expected all files to be copied, got %d", budget, result.NumSampled)
+		}
+
+		if uint64(len(listFiles(t, dst))) != result.NumSampled {
+			t.Errorf("budget %d: sampled %d files but found %d", budget, result.NumSampled, len(listFiles(t, dst)))
+		}
+	}
+}
+
+func TestSampleWeighted(t *testing.T) {
+	// Half of the files are nine times larger than the other half
+	files := make(map[string]string, 41)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("large%02d.txt", i)] = strings.Repeat("l", 90)
+		files[fmt.Sprintf("small%02d.txt", i)] = strings.Repeat("s", 10)
+	}
+	files["empty.txt"] = ""
+
+	src := makeTree(t, files)
+	defer os.RemoveAll(src)
+
+	// Count the large files selected over many reproducible samples
+	sample := func(weighted bool) (large, total int) {
+		for seed := int64(1); seed <= 40; seed++ {
+			dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			defer os.RemoveAll(dst)
+
+			fs := makeWalker()
+			fs.Seed = seed
+
+			var result string
+			if weighted {
+				result, err = fs.SampleWeighted(src, dst, 10)
+			} else {
+				result, err = fs.SampleN(src, dst, 10)
+			}
+
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if weighted != strings.Contains(result, "(size-weighted)") {
+				t.Errorf("unexpected summary of the sample: %q", result)
+			}
+
+			for _, name := range listFiles(t, dst) {
+				if name == "empty.txt" && weighted {
+					t.Error("expected an empty file never to be selected by a weighted sample")
+				}
+
+				if strings.HasPrefix(name, "large") {
+					large++
+				}
+				total++
+			}
+		}
+		return large, total
+	}
+
+	// Drawing 10 of the files by size without replacement selects large
+	// files about 85% of the time, whereas a uniform sample selects them
+	// about half of the time.
+	large, total := sample(true)
+	if total != 400 {
+		t.Fatalf("expected 400 files sampled, got %d", total)
+	}
+
+	if ratio := float64(large) / float64(total); ratio < 0.78 || ratio > 0.92 {
+		t.Errorf("expected about 85%% large files in the weighted samples, got %0.1f%%", ratio*100)
+	}
+
+	if large, total = sample(false); float64(large)/float64(total) > 0.6 {
+		t.Errorf("expected about half large files in the uniform samples, got %d of %d", large, total)
+	}
+
+	// The weighted sample is reproducible with the same seed
+	samples := make([][]string, 2)
+	for i := range samples {
+		dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dst)
+
+		fs := makeWalker()
+		fs.Seed = 42
+		if _, err := fs.SampleWeighted(src, dst, 10); err != nil {
+			t.Fatal(err.Error())
+		}
+		samples[i] = listFiles(t, dst)
+	}
+
+	if strings.Join(samples[0], ",") != strings.Join(samples[1], ",") {
+		t.Errorf("expected the same weighted sample with the same seed, got %v and %v", samples[0], samples[1])
+	}
+}
@@ -0,0 +1,46 @@
+package urfs
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Search the specified paths for files whose path matches the regular
+// expression pattern. Returns a list of all matching paths, printing them to
+// Output as they're discovered if required. An invalid pattern returns an
+// error before any of the paths are walked.
+func (fs *FSWalker) Search(pattern string, print bool, paths ...string) ([]string, error) {
+	// Compile the regular expression before walking
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile search pattern: %s", err)
+	}
+
+	// Synchronize the appending of matches from concurrent workers
+	var mu sync.Mutex
+	matches := make([]string, 0)
+
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			if !regex.MatchString(path) {
+				return "", nil
+			}
+
+			mu.Lock()
+			matches = append(matches, path)
+			if print {
+				fmt.Fprintln(fs.output(), path)
+			}
+			mu.Unlock()
+
+			return path, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, nil
+}
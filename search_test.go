@@ -0,0 +1,49 @@
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.jpg":     "a",
+		"b.png":     "b",
+		"c.txt":     "c",
+		"sub/d.jpg": "d",
+		".f.jpg":    "f",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	matches, err := fs.Search(`.*\.(jpg|png)$`, false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sort.Strings(matches)
+	expected := []string{
+		filepath.Join(root, "a.jpg"),
+		filepath.Join(root, "b.png"),
+		filepath.Join(root, "sub", "d.jpg"),
+	}
+
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, got %d: %v", len(expected), len(matches), matches)
+	}
+
+	for i, path := range expected {
+		if matches[i] != path {
+			t.Errorf("expected match %q, got %q", path, matches[i])
+		}
+	}
+}
+
+func TestSearchBadPattern(t *testing.T) {
+	fs := makeWalker()
+	if _, err := fs.Search(`(unclosed`, false, "does-not-exist"); err == nil {
+		t.Fatal("expected an error compiling an invalid pattern")
+	}
+}
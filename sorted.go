@@ -0,0 +1,83 @@
+package urfs
+
+import (
+	"sort"
+	"sync"
+)
+
+// Internal collection of the paths discovered by a sorted walk, along with
+// the results that are held until they can be emitted in path order.
+type sortedPaths struct {
+	sync.Mutex
+	paths   []string       // paths collected by the walk goroutines
+	order   map[string]int // position of each path once sorted
+	pending map[int]string // results waiting on the results of preceding paths
+	next    int            // position of the next result to emit
+}
+
+// Internal helper function that collects the path to be sorted once all of
+// the paths have been discovered by the walk goroutines.
+func (fs *FSWalker) collect(path string) {
+	fs.sorted.Lock()
+	fs.sorted.paths = append(fs.sorted.paths, path)
+	fs.sorted.Unlock()
+}
+
+// Internal helper function that sorts the collected paths and sends them to
+// the workers in order. Paths discovered more than once, e.g. under nested
+// roots, are only sent once.
+func (fs *FSWalker) queueSorted() error {
+	fs.sorted.Lock()
+	sort.Strings(fs.sorted.paths)
+	paths := make([]string, 0, len(fs.sorted.paths))
+	for i, path := range fs.sorted.paths {
+		if i == 0 || path != fs.sorted.paths[i-1] {
+			paths = append(paths, path)
+		}
+	}
+
+	fs.sorted.paths = nil
+	fs.sorted.order = make(map[string]int, len(paths))
+	for i, path := range paths {
+		fs.sorted.order[path] = i
+	}
+	fs.sorted.pending = make(map[int]string)
+	fs.sorted.next = 0
+	fs.sorted.Unlock()
+
+	for _, path := range paths {
+		if err := fs.send(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Internal helper function that holds the result of the path until the
+// results of all of the preceding paths have been emitted, then emits all of
+// the consecutive results that are ready. Empty results are not emitted, but
+// still release the results that follow them.
+func (fs *FSWalker) emitSorted(path, r string) error {
+	fs.sorted.Lock()
+	defer fs.sorted.Unlock()
+
+	fs.sorted.pending[fs.sorted.order[path]] = r
+	for {
+		r, ok := fs.sorted.pending[fs.sorted.next]
+		if !ok {
+			return nil
+		}
+
+		delete(fs.sorted.pending, fs.sorted.next)
+		fs.sorted.next++
+		if r == "" {
+			continue
+		}
+
+		select {
+		case fs.results <- r:
+		case <-fs.ctx.Done():
+			return fs.ctx.Err()
+		}
+	}
+}
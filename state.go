@@ -0,0 +1,101 @@
+package urfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// SampleState records the source paths of the files copied by a sample in a
+// newline delimited file so that an interrupted sample can be resumed. The
+// paths already in the file are loaded when it is opened, and a sample with
+// the state skips them rather than copying them again. Each path is written
+// to the file as soon as its copy completes, so a crash loses at most the
+// file that was being copied.
+type SampleState struct {
+	Path  string // path to the state file
+	Count uint64 // number of paths loaded when the state was opened
+
+	done map[string]bool
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenSampleState loads the source paths from the state file at path if it
+// exists, then opens it to append the paths of the files that are copied.
+func OpenSampleState(path string) (*SampleState, error) {
+	s := &SampleState{Path: path, done: make(map[string]bool)}
+
+	if f, err := os.Open(path); err == nil {
+		paths, err := readState(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range paths {
+			s.done[p] = true
+		}
+		s.Count = uint64(len(s.done))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s.file = file
+	return s, nil
+}
+
+// Internal helper function that reads the paths from a state file, one per
+// line. Unlike ReadPaths, lines are not trimmed and comments are not
+// skipped, since the state contains paths exactly as they were copied, which
+// may have leading or trailing spaces or start with a #.
+func readState(r io.Reader) ([]string, error) {
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			paths = append(paths, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// Done returns true if the file at the source path has already been copied.
+func (s *SampleState) Done(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[path]
+}
+
+// Add the source path of a file that has been copied, writing it to the
+// state file immediately. It is safe to call Add from multiple goroutines.
+func (s *SampleState) Add(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done[path] {
+		return nil
+	}
+
+	if _, err := fmt.Fprintln(s.file, path); err != nil {
+		return err
+	}
+	s.done[path] = true
+	return nil
+}
+
+// Close the state file.
+func (s *SampleState) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,137 @@
+package urfs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CountStats computes summary statistics of the sizes of the files in the
+// specified paths, including the median and percentiles which are not skewed
+// by a few very large files as the mean is.
+//
+// NOTE: unlike Count, which streams the sizes into running totals, this
+// method retains one int64 per file in memory in order to compute the
+// percentiles, which may be significant for very large directories.
+func (fs *FSWalker) CountStats(paths ...string) (*SizeStats, error) {
+	var mu sync.Mutex
+	sizes := make([]int64, 0)
+
+	var duration time.Duration
+	for _, path := range paths {
+		err := fs.Walk(path, func(path string) (string, error) {
+			info, err := fs.stat(path)
+			if err != nil {
+				return "", err
+			}
+
+			if info.IsDir() {
+				return "", nil
+			}
+
+			mu.Lock()
+			sizes = append(sizes, info.Size())
+			mu.Unlock()
+			return path, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+		duration += fs.duration
+	}
+
+	stats := NewSizeStats(sizes)
+	stats.Duration = duration
+	return stats, nil
+}
+
+// SizeStats holds summary statistics of a collection of file sizes in bytes.
+type SizeStats struct {
+	Files  uint64  `json:"files"`  // number of files
+	Bytes  uint64  `json:"bytes"`  // total number of bytes
+	Min    int64   `json:"min"`    // size of the smallest file
+	Max    int64   `json:"max"`    // size of the largest file
+	Mean   float64 `json:"mean"`   // average file size
+	Median float64 `json:"median"` // median file size
+	P90    int64   `json:"p90"`    // 90th percentile file size
+	P99    int64   `json:"p99"`    // 99th percentile file size
+
+	Duration time.Duration `json:"duration"` // time it took to walk the files, if known
+}
+
+// NewSizeStats computes the statistics of the file sizes, sorting the sizes
+// in place. If there are no sizes, all of the statistics are zero.
+func NewSizeStats(sizes []int64) *SizeStats {
+	stats := &SizeStats{Files: uint64(len(sizes))}
+	if len(sizes) == 0 {
+		return stats
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	for _, size := range sizes {
+		stats.Bytes += uint64(size)
+	}
+
+	n := len(sizes)
+	stats.Min = sizes[0]
+	stats.Max = sizes[n-1]
+	stats.Mean = float64(stats.Bytes) / float64(n)
+
+	if n%2 == 1 {
+		stats.Median = float64(sizes[n/2])
+	} else {
+		stats.Median = float64(sizes[n/2-1]+sizes[n/2]) / 2
+	}
+
+	stats.P90 = percentile(sizes, 90)
+	stats.P99 = percentile(sizes, 99)
+	return stats
+}
+
+// Throughput returns the number of files and bytes walked per second, or
+// zeros if the duration of the walk is unknown.
+func (s *SizeStats) Throughput() (filesPerSec, bytesPerSec float64) {
+	return throughput(s.Files, s.Bytes, s.Duration)
+}
+
+// String returns a human readable summary of the statistics, including the
+// throughput of the walk if its duration is known.
+func (s *SizeStats) String() string {
+	summary := fmt.Sprintf(
+		"%d files %s: min %s, max %s, mean %s, median %s, p90 %s, p99 %s",
+		s.Files, HumanizeBytes(s.Bytes), HumanizeBytes(uint64(s.Min)),
+		HumanizeBytes(uint64(s.Max)), HumanizeBytes(uint64(s.Mean)),
+		HumanizeBytes(uint64(s.Median)), HumanizeBytes(uint64(s.P90)),
+		HumanizeBytes(uint64(s.P99)),
+	)
+
+	if files, bytes := s.Throughput(); files > 0 {
+		summary += fmt.Sprintf(" in %s (%0.1f files/s, %s/s)", s.Duration, files, HumanizeBytes(uint64(bytes)))
+	}
+	return summary
+}
+
+// Internal helper function that computes the number of files and bytes
+// processed per second over the duration, or zeros if the duration is not
+// positive.
+func throughput(files, bytes uint64, duration time.Duration) (filesPerSec, bytesPerSec float64) {
+	if duration <= 0 {
+		return 0, 0
+	}
+
+	secs := duration.Seconds()
+	return float64(files) / secs, float64(bytes) / secs
+}
+
+// Internal helper function that computes the nearest rank percentile (p
+// between 0 and 100) of the sorted, non-empty values.
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,87 @@
+package urfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSizeStats(t *testing.T) {
+	sizes := make([]int64, 0, 100)
+	for i := int64(100); i > 0; i-- {
+		sizes = append(sizes, i)
+	}
+
+	stats := NewSizeStats(sizes)
+	if stats.Files != 100 || stats.Bytes != 5050 {
+		t.Errorf("expected 100 files 5050 bytes, got %d files %d bytes", stats.Files, stats.Bytes)
+	}
+
+	if stats.Min != 1 || stats.Max != 100 {
+		t.Errorf("expected min 1 max 100, got min %d max %d", stats.Min, stats.Max)
+	}
+
+	if stats.Mean != 50.5 || stats.Median != 50.5 {
+		t.Errorf("expected mean and median 50.5, got mean %f median %f", stats.Mean, stats.Median)
+	}
+
+	if stats.P90 != 90 || stats.P99 != 99 {
+		t.Errorf("expected p90 90 p99 99, got p90 %d p99 %d", stats.P90, stats.P99)
+	}
+
+	// odd number of sizes uses the middle value as the median
+	if median := NewSizeStats([]int64{1, 1000, 3}).Median; median != 3 {
+		t.Errorf("expected median 3, got %f", median)
+	}
+
+	// no sizes should not panic
+	if empty := NewSizeStats(nil); empty.Files != 0 || empty.Median != 0 {
+		t.Errorf("expected zero stats for no sizes, got %+v", empty)
+	}
+}
+
+func TestCountStats(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     strings.Repeat("a", 10),
+		"b.txt":     strings.Repeat("b", 20),
+		"sub/c.txt": strings.Repeat("c", 1000),
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	stats, err := fs.CountStats(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if stats.Files != 3 || stats.Min != 10 || stats.Max != 1000 || stats.Median != 20 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	stats := &SizeStats{Files: 100, Bytes: 5000, Duration: 2 * time.Second}
+	if files, bytes := stats.Throughput(); files != 50 || bytes != 2500 {
+		t.Errorf("expected 50 files/s and 2500 bytes/s, got %f and %f", files, bytes)
+	}
+
+	if summary := stats.String(); !strings.HasSuffix(summary, "in 2s (50.0 files/s, 2.4 KiB/s)") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+
+	result := &SampleResult{NumSampled: 30, NumBytes: 3 << 20, Duration: 500 * time.Millisecond}
+	if files, bytes := result.Throughput(); files != 60 || bytes != 6<<20 {
+		t.Errorf("expected 60 files/s and %d bytes/s, got %f and %f", 6<<20, files, bytes)
+	}
+
+	// An unknown duration has no throughput
+	stats.Duration = 0
+	if files, bytes := stats.Throughput(); files != 0 || bytes != 0 {
+		t.Errorf("expected no throughput without a duration, got %f and %f", files, bytes)
+	}
+
+	if summary := stats.String(); strings.Contains(summary, "files/s") {
+		t.Errorf("expected no throughput in summary %q", summary)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package urfs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a/file1.txt": "1",
+		"b/file2.txt": "2",
+	})
+	defer os.RemoveAll(root)
+
+	// link to a directory outside of the walk, and a cycle back to the root
+	outside := makeTree(t, map[string]string{"file3.txt": "3"})
+	defer os.RemoveAll(outside)
+
+	if err := os.Symlink(outside, filepath.Join(root, "a", "out")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := os.Symlink(root, filepath.Join(root, "b", "cycle")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := os.Symlink(filepath.Join(root, "nothing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// without following symlinks only the regular files are discovered
+	fs := makeWalker()
+	matches, err := fs.Search(".*", false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 files without following links, got %v", matches)
+	}
+
+	// following symlinks discovers the linked file, but does not cycle
+	fs = makeWalker()
+	fs.FollowSymlinks = true
+	matches, err = fs.Search(".*", false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sort.Strings(matches)
+	expected := []string{
+		filepath.Join(root, "a", "file1.txt"),
+		filepath.Join(root, "a", "out", "file3.txt"),
+		filepath.Join(root, "b", "file2.txt"),
+	}
+
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d files following links, got %v", len(expected), matches)
+	}
+
+	for i, path := range expected {
+		if matches[i] != path {
+			t.Errorf("expected match %q, got %q", path, matches[i])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package urfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// TreeStats describes the shape of the directory tree at root: the minimum,
+// maximum and mean depth of the files below the root, where files directly
+// in the root have depth 1, and the minimum, maximum and mean number of
+// files in each directory. Only directories that directly contain files
+// are included in the number of files per directory.
+func (fs *FSWalker) TreeStats(root string) (*TreeShape, error) {
+	var mu sync.Mutex
+	shape := &TreeShape{Path: root}
+	dirs := make(map[string]uint64)
+	depths := 0
+
+	err := fs.Walk(root, func(path string) (string, error) {
+		depth, err := fs.depth(root, path)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if shape.Files == 0 || depth < shape.MinDepth {
+			shape.MinDepth = depth
+		}
+
+		if depth > shape.MaxDepth {
+			shape.MaxDepth = depth
+		}
+
+		shape.Files++
+		depths += depth
+		dirs[filepath.Dir(path)]++
+		return path, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if shape.Files == 0 {
+		return shape, nil
+	}
+
+	shape.Dirs = uint64(len(dirs))
+	shape.MeanDepth = float64(depths) / float64(shape.Files)
+	shape.MeanFiles = float64(shape.Files) / float64(shape.Dirs)
+
+	for _, files := range dirs {
+		if shape.MinFiles == 0 || files < shape.MinFiles {
+			shape.MinFiles = files
+		}
+
+		if files > shape.MaxFiles {
+			shape.MaxFiles = files
+		}
+	}
+
+	return shape, nil
+}
+
+// TreeShape holds the depth and files per directory statistics of a tree.
+type TreeShape struct {
+	Path      string  `json:"path"`       // root of the tree
+	Files     uint64  `json:"files"`      // number of files in the tree
+	Dirs      uint64  `json:"dirs"`       // number of directories that contain files
+	MinDepth  int     `json:"min_depth"`  // depth of the shallowest file
+	MaxDepth  int     `json:"max_depth"`  // depth of the deepest file
+	MeanDepth float64 `json:"mean_depth"` // average depth of the files
+	MinFiles  uint64  `json:"min_files"`  // fewest files in a directory
+	MaxFiles  uint64  `json:"max_files"`  // most files in a directory
+	MeanFiles float64 `json:"mean_files"` // average number of files per directory
+}
+
+// String returns a human readable summary of the shape of the tree.
+func (s *TreeShape) String() string {
+	return fmt.Sprintf(
+		"%s: %d files in %d directories: depth min %d, max %d, mean %0.1f; files per directory min %d, max %d, mean %0.1f",
+		s.Path, s.Files, s.Dirs, s.MinDepth, s.MaxDepth, s.MeanDepth,
+		s.MinFiles, s.MaxFiles, s.MeanFiles,
+	)
+}
@@ -0,0 +1,56 @@
+package urfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTreeStats(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":         "a",
+		"b.txt":         "b",
+		"c.txt":         "c",
+		"one/d.txt":     "d",
+		"one/two/e.txt": "e",
+		"one/two/f.txt": "f",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	shape, err := fs.TreeStats(root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := TreeShape{
+		Path:      root,
+		Files:     6,
+		Dirs:      3,
+		MinDepth:  1,
+		MaxDepth:  3,
+		MeanDepth: 11.0 / 6,
+		MinFiles:  1,
+		MaxFiles:  3,
+		MeanFiles: 2,
+	}
+
+	if *shape != expected {
+		t.Errorf("expected %+v, got %+v", expected, *shape)
+	}
+
+	// An empty tree has no files or directories
+	empty, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(empty)
+
+	if shape, err = fs.TreeStats(empty); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if shape.Files != 0 || shape.Dirs != 0 || shape.MeanDepth != 0 {
+		t.Errorf("expected an empty shape, got %+v", *shape)
+	}
+}
@@ -6,24 +6,37 @@
 package urfs
 
 import (
+	"errors"
+	"io"
+	iofs "io/fs"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 // DefaultWorkers is the default number of worker threads to access system
 // resources to prevent too many files open or max number of threads.
 const DefaultWorkers = 5000
 
-// DefaultBuffer is the size of the channels used to store paths and results.
+// DefaultBuffer is the default size of the channels used to store paths and
+// results.
 const DefaultBuffer = 1000
 
+// ProgressInterval is the number of results between calls to OnProgress.
+const ProgressInterval = 1000
+
+// DefaultHiddenPrefixes are the prefixes of the names of hidden files and
+// directories used if HiddenPrefixes is empty.
+var DefaultHiddenPrefixes = []string{".", "~"}
+
 //===========================================================================
 // Initialization
 //===========================================================================
@@ -44,57 +57,225 @@ func init() {
 // if the WalkFunc does nothing, it should return an empty string.
 type WalkFunc func(path string) (string, error)
 
+// ProgressFunc is called periodically during a walk with the current number
+// of paths discovered and results produced. It is called on the goroutine
+// that gathers results, so it should be fast and must not block.
+type ProgressFunc func(paths, results uint64)
+
+// FileFunc is called once for every file that the WalkFunc was successfully
+// applied to with the path and size of the file in bytes. It is called
+// concurrently by the workers, so it must synchronize any shared state.
+type FileFunc func(path string, size int64)
+
+// CopyFunc is called by Sample with the path of the file being copied, the
+// number of bytes copied so far, and the total size of the file. It is
+// called concurrently by the workers, so it must synchronize any shared state.
+type CopyFunc func(path string, copied, total int64)
+
 // FSWalker provides an API for walking a file system and applying a function
 // concurrently to every path discovered. It is meant to handle much larger
-// directories than ioutil.Walk. A set number of workers (by default 5000) is
-// used to apply the function so that maximum files open or maximum thread
-// limits are not reached, crashing the program.
+// directories than ioutil.Walk. A bounded number of workers (by default at
+// most 5000) is used to apply the function so that maximum files open or
+// maximum thread limits are not reached, crashing the program. The pool
+// starts with a single worker and grows only while discovered paths are
+// waiting to be processed, so small directories use few goroutines.
 type FSWalker struct {
-	Workers    int             // number of workers that apply the func
-	SkipHidden bool            // whether or not to skip hidden files and directories
-	SkipDirs   bool            // whether or not to skip directories
-	Match      string          // pattern to match files on (glob syntax)
-	root       string          // root path currently being walked
-	paths      chan string     // channel that discovered paths are passed to
-	nPaths     uint64          // total number of paths discovered
-	results    chan string     // paths that were operated on by the function
-	nResults   uint64          // total number of results
-	group      *errgroup.Group // group of threads being waited on
-	ctx        context.Context // context of concurrent operation
-	started    time.Time       // the time the last walk was started
-	duration   time.Duration   // amount of time it took to walk and apply func
+	Workers              int             // maximum number of workers that apply the func
+	Buffer               int             // size of the path and result channels, applied on Reset
+	DirWorkers           int             // maximum number of directories read concurrently by the walk
+	SkipHidden           bool            // whether or not to skip hidden files and directories
+	IncludeHidden        []string        // patterns of hidden files to include even if skipping hidden
+	HiddenPrefixes       []string        // prefixes of hidden names (DefaultHiddenPrefixes if empty)
+	SkipDirNames         []string        // names of directories to skip anywhere in the walk, e.g. node_modules
+	SkipDirs             bool            // whether or not to skip directories
+	Match                string          // pattern to match files on (glob syntax, all files if empty)
+	Patterns             []string        // additional patterns, a file matches if any of them match
+	MatchPath            bool            // match the path relative to the root rather than the name
+	IgnoreCase           bool            // match and exclude patterns regardless of case
+	Exclude              string          // comma separated patterns to exclude files on (glob syntax)
+	Extensions           []string        // only process files with these extensions (case-insensitive)
+	ExcludeExtensions    []string        // skip files with these extensions (case-insensitive)
+	Invert               bool            // only process files that do not match the pattern or extensions
+	MimeTypes            []string        // only process files whose detected MIME type is one of these
+	Seed                 int64           // seed for reproducible random sampling (0 for random)
+	FollowSymlinks       bool            // whether or not to follow symbolic links
+	Preserve             bool            // preserve file mode and times when copying
+	DryRun               bool            // select files to sample but do not copy them
+	Sync                 bool            // skip sampled files unchanged in dst, preserving times
+	Overwrite            bool            // overwrite sampled files that already exist in dst
+	Unique               bool            // skip sampled files whose contents were already copied
+	Flatten              bool            // copy sampled files directly into dst by name
+	PreservePath         bool            // copy sampled files to their full source path under dst
+	Rename               RenameFunc      // if set, names the files copied by a sample
+	MaxBytes             int64           // maximum bytes of files copied by a sample (0 for no limit)
+	Gzip                 bool            // compress sampled files with gzip when copying
+	Manifest             *Manifest       // if set, records every file copied by a sample
+	State                *SampleState    // if set, skips and records the files copied by a sample
+	IncludeEmpty         bool            // count zero-byte files (default true)
+	DedupHardlinks       bool            // count hard linked files only once
+	DiskUsage            bool            // count the bytes allocated on disk rather than the apparent size
+	IntoArchives         bool            // count the files inside of .zip and .tar(.gz) archives
+	HeadBytes            int64           // hash at most this many bytes of each file to find duplicates (0 for all)
+	Sorted               bool            // process paths and emit results in lexicographic order
+	Profile              bool            // record how well the workers keep up with the walk
+	RateLimit            int64           // maximum bytes per second copied by all workers (0 for no limit)
+	CopyRetries          int             // number of times to retry a copy that fails with a transient error
+	CopyBackoff          time.Duration   // time to wait before the first retry, doubled after each retry
+	MaxDepth             int             // maximum depth below the root to walk (0 for no limit)
+	MinSize              int64           // minimum size of files in bytes to process
+	MaxSize              int64           // maximum size of files in bytes to process (0 for no limit)
+	ModifiedAfter        time.Time       // only process files modified at or after this time
+	ModifiedBefore       time.Time       // only process files modified strictly before this time
+	ContinueOnError      bool            // collect per-file errors rather than aborting
+	SkipPermissionErrors bool            // skip paths that cannot be accessed due to permissions
+	FileTimeout          time.Duration   // abandon the func on a file after this long (0 for no limit)
+	OnProgress           ProgressFunc    // called periodically with the walk progress
+	OnFile               FileFunc        // called by the workers for every file processed
+	OnCopy               CopyFunc        // called with the progress of every file copied by a sample
+	Logger               Logger          // receives diagnostic messages, e.g. skipped paths (no-op by default)
+	Output               io.Writer       // where Count and Search print results if asked to (os.Stdout if nil)
+	DirFunc              WalkFunc        // if set, applied to each directory on the walk
+	FS                   iofs.FS         // if set, walk this file system rather than the real one
+	paths                chan string     // channel that discovered paths are passed to
+	dirs                 chan string     // channel that directories are passed to the DirFunc
+	nPaths               uint64          // total number of paths discovered
+	results              chan string     // paths that were operated on by the function
+	nResults             uint64          // total number of results
+	nSkipped             uint64          // number of sampled files skipped when syncing
+	nExisting            uint64          // number of sampled files skipped since they exist in dst
+	nDupes               uint64          // number of sampled files skipped as duplicates if unique
+	nResumed             uint64          // number of sampled files skipped since the state has them
+	nBytes               int64           // bytes of the files copied by a sample
+	spent                uint32          // set to 1 once a sampled file does not fit in MaxBytes
+	digests              map[string]bool // digests of the contents of files copied if unique
+	digestsMu            sync.Mutex      // synchronizes access to the digests between workers
+	group                *errgroup.Group // group of threads being waited on
+	ctx                  context.Context // context of concurrent operation
+	parent               context.Context // context the walker was reset with
+	cancel               func()          // cancels the context created by Reset
+	cancelMu             sync.Mutex      // synchronizes canceling the walk with resetting it
+	workerFn             func() error    // worker applying the walk function to paths
+	nWorkers             int             // number of workers started in the pool
+	poolMu               sync.Mutex      // synchronizes growing the pool between walk goroutines
+	fixedPool            bool            // start all workers up front rather than adapting
+	matches              []string        // match patterns with braces expanded when the walk starts
+	excludes             []string        // exclude patterns parsed when the walk starts
+	extensions           map[string]bool // lower case extensions parsed when the walk starts
+	excludeExts          map[string]bool // lower case excluded extensions parsed when the walk starts
+	flatNames            map[string]bool // names used when flattening sampled files
+	flatMu               sync.Mutex      // synchronizes access to the flattened and renamed names
+	renamed              map[string]bool // relative paths of sampled files named by Rename
+	nRenamed             uint64          // index of the last file copied with a Rename name
+	started              time.Time       // the time the last walk was started
+	duration             time.Duration   // amount of time it took to walk and apply func
+	visited              map[fileID]bool // directories visited when following symlinks
+	visitedFI            []os.FileInfo   // visited directories without a file identity
+	visitMu              sync.Mutex      // synchronizes the visited directories between walk goroutines
+	errors               *errorCollector // per-file errors if continuing on error
+	denied               *errorCollector // permission errors of paths that were skipped
+	timedOut             []string        // paths the func was abandoned on after the file timeout
+	timedOutMu           sync.Mutex      // synchronizes access to the timed out paths
+	limiter              *rate.Limiter   // limits the rate of copies if RateLimit is set
+	sorted               *sortedPaths    // paths collected and results held if Sorted is set
+	prof                 *profiler       // profile of the walks if Profile is set
 }
 
 // Init the FSWalker and associated data structures.
 func (fs *FSWalker) Init(ctx context.Context) {
 	// Set up FSWalker defaults
 	fs.Workers = DefaultWorkers
+	fs.Buffer = DefaultBuffer
+	fs.CopyBackoff = DefaultCopyBackoff
 	fs.SkipHidden = true
 	fs.SkipDirs = true
-	fs.Match = "*"
+	fs.IncludeEmpty = true
+	fs.Overwrite = true
+	fs.Logger = nopLogger{}
 
 	// Reset the required data structures
 	fs.Reset(ctx)
 }
 
-// Reset the FSWalker and create required data structures.
+// Reset the FSWalker and create required data structures. If the context is
+// nil, a new context is created with the deadline of the previous context.
 func (fs *FSWalker) Reset(ctx context.Context) {
+	// Release the context created by the previous reset
+	fs.Close()
+
+	var cancel func()
 	if ctx == nil {
 		// Create a new context
 		ctx = context.Background()
 		deadline, ok := fs.ctx.Deadline()
 		if ok {
-			ctx, _ = context.WithDeadline(ctx, deadline)
+			ctx, cancel = context.WithDeadline(ctx, deadline)
 		}
 	}
 
-	fs.paths = make(chan string, DefaultBuffer)
-	fs.results = make(chan string, DefaultBuffer)
+	// Ensure the walk can be canceled by Cancel
+	if cancel == nil {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	fs.cancelMu.Lock()
+	fs.cancel = cancel
+	fs.cancelMu.Unlock()
+
+	buffer := fs.Buffer
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	fs.paths = make(chan string, buffer)
+	fs.dirs = make(chan string, buffer)
+	fs.results = make(chan string, buffer)
+	fs.parent = ctx
 	fs.group, fs.ctx = errgroup.WithContext(ctx)
 	fs.nPaths = 0
 	fs.nResults = 0
+	fs.nSkipped = 0
+	fs.nExisting = 0
+	fs.nDupes = 0
+	fs.nResumed = 0
+	fs.nBytes = 0
+	fs.spent = 0
+	fs.digests = make(map[string]bool)
 	fs.started = time.Time{}
 	fs.duration = time.Duration(0)
+	fs.visited = make(map[fileID]bool)
+	fs.visitedFI = nil
+	fs.errors = new(errorCollector)
+	fs.denied = new(errorCollector)
+	fs.timedOut = nil
+	fs.flatNames = make(map[string]bool)
+	fs.renamed = make(map[string]bool)
+	fs.nRenamed = 0
+	fs.sorted = new(sortedPaths)
+}
+
+// Close releases the resources associated with any context created by the
+// walker when it was reset, and should be called when done with the walker.
+func (fs *FSWalker) Close() {
+	fs.cancelMu.Lock()
+	defer fs.cancelMu.Unlock()
+
+	if fs.cancel != nil {
+		fs.cancel()
+		fs.cancel = nil
+	}
+}
+
+// Cancel stops a running walk, which returns context.Canceled once the
+// workers have stopped. Cancel is safe to call from another goroutine, e.g.
+// a signal handler. Because the walker is reset before each subsequent walk,
+// it can be used to walk again after it has been canceled.
+func (fs *FSWalker) Cancel() {
+	fs.cancelMu.Lock()
+	defer fs.cancelMu.Unlock()
+
+	if fs.cancel != nil {
+		fs.cancel()
+	}
 }
 
 // Walk the file systemfrom the path and apply the specified function.
@@ -102,55 +283,383 @@ func (fs *FSWalker) Reset(ctx context.Context) {
 // files and filter the paths being processed (if empty string is passed in,
 // then the pattern is set to "*").
 //
-// NOTE: once walked, the FSWalker must be reinitialized to walk again.
+// If DirFunc is set, it is applied to each directory on the walk (except
+// hidden directories if SkipHidden is set) by a separate worker, so that
+// directories are processed concurrently with files in no particular order.
+//
+// If ContinueOnError is set, errors accessing or applying the function to
+// individual paths do not cancel the walk; instead they are collected and
+// returned together as WalkErrors once the walk is complete.
+//
+// If Sorted is set, all of the paths are discovered before any of them are
+// processed, then they are sent to the workers in lexicographic order and
+// the results are emitted in the same order, so that the output of the walk
+// is deterministic. This trades streaming for determinism, since processing
+// waits on the complete walk and the paths are all kept in memory.
+//
+// The FSWalker can be used to walk again once the walk is complete; it is
+// automatically reset, preserving the deadline of the configured context.
+//
+// If the path is a single regular file or an empty directory, the walk is
+// performed in the calling goroutine without starting any workers.
 func (fs *FSWalker) Walk(path string, walkFn WalkFunc) error {
+	if fs.trivial(path) {
+		return fs.walkSync(path, walkFn)
+	}
+	return fs.WalkMulti([]string{path}, walkFn)
+}
+
+// WalkMulti walks each of the paths concurrently and applies the specified
+// function as Walk does. Each path is walked by its own goroutine, but all
+// of the paths discovered are processed by a single pool of workers, so
+// that many small directories can be walked without waiting on each other.
+// The walk function is called with paths from all of the roots; to attribute
+// a path to its root, match it against the roots, which should not overlap.
+func (fs *FSWalker) WalkMulti(paths []string, walkFn WalkFunc) error {
+	return fs.run(fs.walk(paths), walkFn)
+}
+
+// WalkStream walks the file system from the path and applies the specified
+// function as Walk does, forwarding each non-empty result to the out channel
+// as it arrives so that results can be processed incrementally. The caller
+// owns the out channel and is responsible for closing it after the walk, and
+// must continue to receive from it until the walk returns.
+func (fs *FSWalker) WalkStream(path string, walkFn WalkFunc, out chan<- string) error {
+	return fs.stream(fs.walk([]string{path}), walkFn, out)
+}
+
+// WalkCollect walks the file system from the path with the walker as Walk
+// does, applying fn to each file and collecting its typed results, so that
+// operations can return structured data rather than storing it in closures.
+// The results are in the order the workers processed the files, which is
+// not deterministic. If the walk fails, the results collected before the
+// error are returned along with it.
+func WalkCollect[T any](fs *FSWalker, path string, fn func(path string) (T, error)) ([]T, error) {
+	var mu sync.Mutex
+	results := make([]T, 0)
+
+	err := fs.Walk(path, func(path string) (string, error) {
+		result, err := fn(path)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		results = append(results, result)
+		mu.Unlock()
+		return path, nil
+	})
+
+	// Detach the results from functions abandoned after the FileTimeout
+	mu.Lock()
+	defer mu.Unlock()
+	collected := results
+	results = nil
+	return collected, err
+}
+
+// Internal helper function that applies the function to the paths queued by
+// the producer as stream does, discarding the results, which are only
+// counted.
+func (fs *FSWalker) run(producer func() error, walkFn WalkFunc) error {
+	discard := make(chan string, cap(fs.results))
+	done := make(chan struct{})
+	go func() {
+		for _ = range discard {
+		}
+		close(done)
+	}()
+
+	err := fs.stream(producer, walkFn, discard)
+	close(discard)
+	<-done
+	return err
+}
+
+// Internal helper function that runs the producer, which queues paths,
+// applying the function to the paths queued and forwarding the results to
+// out. The paths and dirs channels are closed once the producer returns.
+func (fs *FSWalker) stream(producer func() error, walkFn WalkFunc, out chan<- string) error {
 	// Compute the duration of the walk
-	fs.started = time.Now()
+	fs.start()
 	defer func() { fs.duration = time.Since(fs.started) }()
 
-	// Set the root path for the walk
-	fs.root = path
+	// Profile the walk if required
+	if fs.Profile {
+		defer fs.startProfile()()
+	}
 
-	// Launch the goroutine that populates the paths
-	fs.group.Go(fs.walk)
+	// Create the worker function and start the pool, which is grown by the
+	// walk goroutines as paths back up unless a fixed pool is required.
+	fs.workerFn = fs.worker(walkFn)
+	fs.nWorkers = 0
+	fs.addWorker()
+	for fs.fixedPool && fs.addWorker() {
+	}
 
-	// Create the worker function and allocate pool
-	worker := fs.worker(walkFn)
-	for w := 0; w < fs.Workers; w++ {
-		fs.group.Go(worker)
+	// Start the worker that applies the directory function, if any
+	if fs.DirFunc != nil {
+		fs.group.Go(fs.dirWorker(fs.DirFunc))
 	}
 
+	// Launch the goroutine that populates the paths, queueing the collected
+	// paths in order once they have all been discovered if sorted.
+	fs.group.Go(func() error {
+		defer close(fs.paths)
+		defer close(fs.dirs)
+		defer fs.prof.done()
+
+		if err := producer(); err != nil {
+			return err
+		}
+
+		if fs.Sorted {
+			return fs.queueSorted()
+		}
+		return nil
+	})
+
 	// Wait for the workers to complete, then close the results channel
 	go func() {
 		fs.group.Wait()
 		close(fs.results)
 	}()
 
-	// Start gathering the results
-	for _ = range fs.results {
-		fs.nResults++
+	// Start gathering the results, reporting progress if required
+	for result := range fs.results {
+		results := atomic.AddUint64(&fs.nResults, 1)
+		if fs.OnProgress != nil && results%ProgressInterval == 0 {
+			fs.OnProgress(atomic.LoadUint64(&fs.nPaths), results)
+		}
+
+		out <- result
+	}
+
+	// Report the final progress of the walk
+	if fs.OnProgress != nil {
+		fs.OnProgress(atomic.LoadUint64(&fs.nPaths), atomic.LoadUint64(&fs.nResults))
+	}
+
+	if err := fs.group.Wait(); err != nil {
+		return err
+	}
+	return fs.errors.err()
+}
+
+// Internal helper function that prepares the walker to start a walk,
+// resetting it if it has already been used to walk.
+func (fs *FSWalker) start() {
+	if !fs.started.IsZero() {
+		fs.Reset(nil)
+	}
+
+	fs.started = time.Now()
+
+	// Limit the rate of copies made by the walk function if required
+	fs.limiter = newRateLimiter(fs.RateLimit)
+}
+
+// Internal helper function that returns true if the path is a regular file
+// or an empty directory, which do not need the workers to be walked. A
+// directory is not trivial if the DirFunc must be applied to it.
+func (fs *FSWalker) trivial(path string) bool {
+	info, err := fs.lstat(path)
+	if err != nil {
+		return false
+	}
+
+	if info.Mode().IsRegular() {
+		return true
+	}
+
+	if !info.IsDir() || fs.DirFunc != nil {
+		return false
+	}
+	return fs.emptyDir(path)
+}
+
+// Internal helper function that walks a trivial path in the calling
+// goroutine, applying the function to the file, if any, directly. Because
+// the paths channel is buffered, the file is queued by the walk as usual
+// and the same filters are applied to it.
+func (fs *FSWalker) walkSync(path string, walkFn WalkFunc) error {
+	fs.start()
+	defer func() { fs.duration = time.Since(fs.started) }()
+
+	if err := fs.ctx.Err(); err != nil {
+		return err
+	}
+
+	err := fs.walk([]string{path})()
+	if err == nil && fs.Sorted {
+		err = fs.queueSorted()
+	}
+
+	close(fs.paths)
+	close(fs.dirs)
+	if err != nil {
+		return err
+	}
+
+	for p := range fs.paths {
+		r, err := fs.process(walkFn, p)
+		if err != nil {
+			return err
+		}
+
+		if r != "" {
+			atomic.AddUint64(&fs.nResults, 1)
+		}
+	}
+
+	if fs.OnProgress != nil {
+		fs.OnProgress(atomic.LoadUint64(&fs.nPaths), atomic.LoadUint64(&fs.nResults))
 	}
+	return fs.errors.err()
+}
+
+// NumPaths returns the number of paths discovered by the walk.
+func (fs *FSWalker) NumPaths() uint64 {
+	return atomic.LoadUint64(&fs.nPaths)
+}
 
-	return fs.group.Wait()
+// NumResults returns the number of paths the walk function operated on.
+func (fs *FSWalker) NumResults() uint64 {
+	return atomic.LoadUint64(&fs.nResults)
 }
 
-// Internal walk function that populates the paths channel.
-func (fs *FSWalker) walk() error {
-	// Ensure that the channel is closed when we've loaded all paths.
-	defer close(fs.paths)
+// Denied returns the permission errors of the paths that were skipped by
+// the last walk because SkipPermissionErrors is set.
+func (fs *FSWalker) Denied() []error {
+	fs.denied.Lock()
+	defer fs.denied.Unlock()
+	return append([]error(nil), fs.denied.errs...)
+}
 
-	// Walk through all the files in the directory specified, ignoring hidden
-	// files and directories if required, matching the pattern if provided.
-	return filepath.Walk(fs.root, fs.filterPaths)
+// TimedOut returns the paths that the walk function was abandoned on by the
+// last walk because it took longer than the FileTimeout.
+func (fs *FSWalker) TimedOut() []string {
+	fs.timedOutMu.Lock()
+	defer fs.timedOutMu.Unlock()
+	return append([]string(nil), fs.timedOut...)
 }
 
-// Internal filter paths function that is passed to filepath.Walk
-func (fs *FSWalker) filterPaths(path string, info os.FileInfo, err error) error {
-	// Propagate any errors
+// Duration returns the amount of time it took to complete the last walk.
+func (fs *FSWalker) Duration() time.Duration {
+	return fs.duration
+}
+
+// Internal walk function that populates the paths channel, walking each of
+// the roots in its own goroutine.
+func (fs *FSWalker) walk(roots []string) func() error {
+	return func() error {
+		// Expand the braces in the match patterns once rather than for every path
+		fs.matches = nil
+		for _, pattern := range fs.patterns() {
+			fs.matches = append(fs.matches, expandBraces(fs.fold(pattern))...)
+		}
+
+		// Parse the exclude patterns once rather than for every path
+		fs.excludes = nil
+		if fs.Exclude != "" {
+			for _, pattern := range strings.Split(fs.Exclude, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					fs.excludes = append(fs.excludes, fs.fold(pattern))
+				}
+			}
+		}
+
+		// Normalize the extensions to lower case with a leading dot
+		fs.extensions = extensionSet(fs.Extensions)
+		fs.excludeExts = extensionSet(fs.ExcludeExtensions)
+
+		// Walk through all the files in the directories specified, ignoring
+		// hidden files and directories if required, matching the pattern if
+		// provided.
+		producers := new(errgroup.Group)
+		for _, root := range roots {
+			root := root
+			producers.Go(func() error {
+				return fs.walkRoot(root, func(path string, info os.FileInfo, err error) error {
+					return fs.filterPaths(root, path, info, err)
+				})
+			})
+		}
+		return producers.Wait()
+	}
+}
+
+// Internal filter paths function that is passed to filepath.Walk for the
+// walk of the specified root.
+func (fs *FSWalker) filterPaths(root, path string, info os.FileInfo, err error) error {
+	// Propagate any errors or collect them and continue if required
 	if err != nil {
+		if fs.SkipPermissionErrors && os.IsPermission(err) {
+			fs.logf("skipped without permission: %s", err)
+			fs.denied.add(err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if fs.ContinueOnError {
+			fs.collectError(err)
+			return nil
+		}
 		return err
 	}
 
+	// Prune directories and skip files deeper than the maximum depth
+	if fs.MaxDepth > 0 {
+		depth, err := fs.depth(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if depth > 0 && depth >= fs.MaxDepth {
+				return filepath.SkipDir
+			}
+		} else if depth > fs.MaxDepth {
+			return nil
+		}
+	}
+
+	// Prune hidden directories and directories with one of the skipped names
+	// (other than the root of the walk) if required so that none of the files
+	// inside of them are processed.
+	if info.IsDir() && path != root {
+		if hidden, err := fs.hidden(info.Name()); err != nil {
+			return err
+		} else if hidden {
+			return filepath.SkipDir
+		}
+
+		for _, name := range fs.SkipDirNames {
+			if info.Name() == name {
+				return filepath.SkipDir
+			}
+		}
+	}
+
+	// Follow symbolic links and prevent cycles if required; links are not
+	// followed when walking an FS.
+	if fs.FollowSymlinks && fs.FS == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fs.followSymlink(root, path, info)
+		}
+
+		if info.IsDir() && fs.visit(info) {
+			return filepath.SkipDir
+		}
+	}
+
+	// Pass directories to the directory function if required
+	if info.IsDir() && fs.DirFunc != nil {
+		return fs.filterDir(path)
+	}
+
 	// Check to ensure that no mode bits are set
 	if !info.Mode().IsRegular() {
 		return nil
@@ -159,11 +668,11 @@ func (fs *FSWalker) filterPaths(path string, info os.FileInfo, err error) error
 	// Get the name of the file without the complete path
 	name := info.Name()
 
-	// Skip hidden files or directories if required.
-	if fs.SkipHidden {
-		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
-			return nil
-		}
+	// Skip hidden files if required
+	if hidden, err := fs.hidden(name); err != nil {
+		return err
+	} else if hidden {
+		return nil
 	}
 
 	// Skip directories if required
@@ -173,17 +682,83 @@ func (fs *FSWalker) filterPaths(path string, info os.FileInfo, err error) error
 		}
 	}
 
-	// Check to see if the pattern matches the file
-	match, err := filepath.Match(fs.Match, name)
+	// Check to see if the pattern matches the file name or relative path
+	target := name
+	if fs.MatchPath {
+		if target, err = filepath.Rel(root, path); err != nil {
+			return err
+		}
+	}
+
+	match, err := matchAny(fs.matches, fs.fold(target))
 	if err != nil {
 		return err
-	} else if !match {
+	}
+
+	// The file must also have one of the extensions if required
+	if match && fs.extensions != nil {
+		match = fs.extensions[strings.ToLower(filepath.Ext(name))]
+	}
+
+	// Skip the file if it does not match, or if it does match when inverted
+	if match == fs.Invert {
+		return nil
+	}
+
+	// Skip the file if its name matches any of the exclude patterns
+	if exclude, err := matchAny(fs.excludes, fs.fold(name)); err != nil {
+		return err
+	} else if exclude {
+		return nil
+	}
+
+	// Skip the file if it has one of the excluded extensions
+	if fs.excludeExts != nil && fs.excludeExts[strings.ToLower(filepath.Ext(name))] {
+		return nil
+	}
+
+	// Skip files outside of the size range if required
+	if size := info.Size(); size < fs.MinSize || (fs.MaxSize > 0 && size > fs.MaxSize) {
+		return nil
+	}
+
+	// Skip files outside of the modification time range if required; the
+	// range includes ModifiedAfter but excludes ModifiedBefore.
+	mtime := info.ModTime()
+	if !fs.ModifiedAfter.IsZero() && mtime.Before(fs.ModifiedAfter) {
+		return nil
+	}
+
+	if !fs.ModifiedBefore.IsZero() && !mtime.Before(fs.ModifiedBefore) {
+		return nil
+	}
+
+	return fs.queue(path)
+}
+
+// Internal helper function that queues the path to be processed by the
+// workers. If sorted, the path is collected to be sent in order once all of
+// the paths have been discovered.
+func (fs *FSWalker) queue(path string) error {
+	if fs.Sorted {
+		fs.collect(path)
 		return nil
 	}
+	return fs.send(path)
+}
 
+// Internal helper function that sends the path to the workers, counting it
+// and growing the pool if required.
+func (fs *FSWalker) send(path string) error {
 	// Increment the total number of paths we've seen.
 	atomic.AddUint64(&fs.nPaths, 1)
 
+	// If paths are waiting for a worker then all workers are busy, so grow
+	// the pool (up to the maximum number of workers) before queueing the path.
+	if len(fs.paths) > 0 {
+		fs.addWorker()
+	}
+
 	select {
 	case fs.paths <- path:
 	case <-fs.ctx.Done():
@@ -193,32 +768,368 @@ func (fs *FSWalker) filterPaths(path string, info os.FileInfo, err error) error
 	return nil
 }
 
+// Internal producer function that queues each of the paths as is, without
+// walking or filtering them.
+func (fs *FSWalker) list(paths []string) func() error {
+	return func() error {
+		for _, path := range paths {
+			if err := fs.queue(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Internal helper function that passes the directory to the directory
+// worker; hidden directories have already been pruned if required.
+func (fs *FSWalker) filterDir(path string) error {
+	select {
+	case fs.dirs <- path:
+	case <-fs.ctx.Done():
+		return fs.ctx.Err()
+	}
+
+	return nil
+}
+
+// Internal helper function that returns the patterns to match files on:
+// Match followed by the Patterns, or "*" to match all files if there are
+// none.
+func (fs *FSWalker) patterns() []string {
+	patterns := make([]string, 0, len(fs.Patterns)+1)
+	for _, pattern := range append([]string{fs.Match}, fs.Patterns...) {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	if len(patterns) == 0 {
+		return []string{"*"}
+	}
+	return patterns
+}
+
+// Internal helper function that returns true if hidden files are skipped
+// and the name starts with one of the hidden prefixes, unless the name
+// matches one of the patterns of hidden files to include.
+func (fs *FSWalker) hidden(name string) (bool, error) {
+	if !fs.SkipHidden || !hasAnyPrefix(name, fs.hiddenPrefixes()) {
+		return false, nil
+	}
+
+	include, err := matchAny(fs.IncludeHidden, name)
+	return !include, err
+}
+
+// Internal helper function that returns the prefixes of hidden names,
+// using the defaults if none are specified.
+func (fs *FSWalker) hiddenPrefixes() []string {
+	if len(fs.HiddenPrefixes) == 0 {
+		return DefaultHiddenPrefixes
+	}
+	return fs.HiddenPrefixes
+}
+
+// Internal helper function that returns true if the name starts with any of
+// the non-empty prefixes.
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Internal helper function that lower cases the pattern or name if matching
+// ignores case, so that both sides of the match are folded the same way.
+func (fs *FSWalker) fold(s string) string {
+	if fs.IgnoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// Internal helper function that normalizes the extensions to a set of lower
+// case extensions with a leading dot, or nil if there are none.
+func extensionSet(exts []string) map[string]bool {
+	if len(exts) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+			set["."+strings.ToLower(ext)] = true
+		}
+	}
+	return set
+}
+
+// Internal helper function that returns true if the name matches any of the
+// glob patterns.
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		match, err := filepath.Match(pattern, name)
+		if err != nil || match {
+			return match, err
+		}
+	}
+	return false, nil
+}
+
+// Internal helper function that computes the depth of the path below the
+// root of the walk: the root has depth 0, the files and directories in the
+// root have depth 1, and so on.
+func (fs *FSWalker) depth(root, path string) (int, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return 0, err
+	}
+
+	if rel == "." {
+		return 0, nil
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1, nil
+}
+
+// Internal helper function that resolves the symbolic link at path and walks
+// the target, passing the discovered paths to filterPaths as though they
+// were found underneath the link. Dangling links are ignored.
+func (fs *FSWalker) followSymlink(root, path string, info os.FileInfo) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return filepath.Walk(target, func(tpath string, tinfo os.FileInfo, err error) error {
+		if tpath == target {
+			// The target is known by the name of the link
+			if tinfo != nil {
+				tinfo = linkInfo{tinfo, info.Name()}
+			}
+			return fs.filterPaths(root, path, tinfo, err)
+		}
+
+		rel, rerr := filepath.Rel(target, tpath)
+		if rerr != nil {
+			return rerr
+		}
+		return fs.filterPaths(root, filepath.Join(path, rel), tinfo, err)
+	})
+}
+
+// Internal helper function that records the directory as visited, returning
+// true if the directory has already been visited. This prevents cycles when
+// following symbolic links. Safe to call from concurrent walk goroutines: the
+// visited directories are only read or modified while holding visitMu, and
+// are only reset by Reset before the walk starts.
+func (fs *FSWalker) visit(info os.FileInfo) bool {
+	fs.visitMu.Lock()
+	defer fs.visitMu.Unlock()
+
+	if id, ok := getFileID(info); ok {
+		if fs.visited[id] {
+			return true
+		}
+		fs.visited[id] = true
+		return false
+	}
+
+	for _, seen := range fs.visitedFI {
+		if os.SameFile(seen, info) {
+			return true
+		}
+	}
+	fs.visitedFI = append(fs.visitedFI, info)
+	return false
+}
+
+// Internal type that identifies a file by device and inode.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// Internal type that renames file info to the name of a symbolic link.
+type linkInfo struct {
+	os.FileInfo
+	name string
+}
+
+// Name returns the name of the symbolic link rather than its target.
+func (i linkInfo) Name() string {
+	return i.name
+}
+
+// Internal helper function that starts a new worker in the pool if the
+// maximum number of workers has not been reached, returning true if a worker
+// was started. Safe to call from concurrent walk goroutines since the pool
+// size is only read or modified while holding poolMu.
+func (fs *FSWalker) addWorker() bool {
+	fs.poolMu.Lock()
+	defer fs.poolMu.Unlock()
+
+	if fs.nWorkers >= fs.Workers {
+		return false
+	}
+
+	fs.nWorkers++
+	fs.group.Go(fs.workerFn)
+	return true
+}
+
+// Internal error returned by apply when the walk function is abandoned.
+var errTimedOut = errors.New("walk function timed out")
+
+// Internal helper function that applies the walk function to the path. If a
+// FileTimeout is set, the function is run in its own goroutine and is
+// abandoned if it does not complete in time, recording the path as timed out
+// so that the worker can continue to the next path. Note that the abandoned
+// goroutine runs until the function returns, and its result is discarded.
+func (fs *FSWalker) apply(walkFn WalkFunc, path string) (string, error) {
+	if fs.FileTimeout <= 0 {
+		return walkFn(path)
+	}
+
+	type result struct {
+		r   string
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		r, err := walkFn(path)
+		done <- result{r, err}
+	}()
+
+	timer := time.NewTimer(fs.FileTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.r, res.err
+	case <-timer.C:
+		fs.logf("abandoned %s after %s", path, fs.FileTimeout)
+		fs.timedOutMu.Lock()
+		fs.timedOut = append(fs.timedOut, path)
+		fs.timedOutMu.Unlock()
+		return "", errTimedOut
+	case <-fs.ctx.Done():
+		return "", fs.ctx.Err()
+	}
+}
+
+// Internal helper function that creates a worker function for the DirFunc
+// to be applied to each directory. Directories are processed concurrently
+// with files, but their results are not counted or returned by the walk.
+func (fs *FSWalker) dirWorker(dirFn WalkFunc) func() error {
+	return func() error {
+		for path := range fs.dirs {
+			if _, err := dirFn(path); err != nil {
+				if fs.ContinueOnError {
+					fs.collectError(err)
+					continue
+				}
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 // Internal helper function that creates a worker function for the specified
 // WalkFunc action to be applied to each path.
 func (fs *FSWalker) worker(walkFn WalkFunc) func() error {
 	return func() error {
+		// Record if the worker goes idle waiting for paths when profiling
+		idle := false
+		fs.prof.wait(len(fs.paths), &idle)
+
 		// Apply the function all paths in the channel
 		for path := range fs.paths {
-			// avoid race condition
-			p := path
-
-			// apply the walk function to the path and return errors
-			r, err := walkFn(p)
+			r, err := fs.process(walkFn, path)
 			if err != nil {
 				return err
 			}
 
 			// store the result and check the context
-			if r != "" {
-
-				select {
-				case fs.results <- r:
-				case <-fs.ctx.Done():
-					return fs.ctx.Err()
-				}
+			if err = fs.emit(path, r); err != nil {
+				return err
 			}
 
+			fs.prof.wait(len(fs.paths), &idle)
 		}
 		return nil
 	}
 }
+
+// Internal helper function that applies the walk function to the path for a
+// worker, returning an empty result if the path is skipped. If an error
+// occurs and ContinueOnError is set, the error is collected and an empty
+// result is returned, otherwise the error is returned to abort the walk.
+func (fs *FSWalker) process(walkFn WalkFunc, p string) (string, error) {
+	// skip files that do not have one of the MIME types; the type is
+	// detected here rather than on the walk to parallelize the reads.
+	if match, err := fs.matchMimeType(p); err != nil {
+		if fs.ContinueOnError {
+			fs.collectError(err)
+			return "", nil
+		}
+		return "", err
+	} else if !match {
+		return "", nil
+	}
+
+	// get the size of the file before the walk function can modify it
+	var size int64
+	if fs.OnFile != nil {
+		if info, err := fs.stat(p); err == nil {
+			size = info.Size()
+		}
+	}
+
+	// apply the walk function to the path and return errors
+	r, err := fs.apply(walkFn, p)
+	if err == errTimedOut {
+		return "", nil
+	}
+
+	if err != nil {
+		if fs.ContinueOnError {
+			fs.collectError(err)
+			return "", nil
+		}
+		return "", err
+	}
+
+	// report that the file was processed
+	if fs.OnFile != nil {
+		fs.OnFile(p, size)
+	}
+	return r, nil
+}
+
+// Internal helper function that sends the result of the path to be gathered
+// by the walk if it is not empty, checking the context. If sorted, results
+// are held until the results of all of the preceding paths have been sent.
+func (fs *FSWalker) emit(path, r string) error {
+	if fs.Sorted {
+		return fs.emitSorted(path, r)
+	}
+
+	if r == "" {
+		return nil
+	}
+
+	select {
+	case fs.results <- r:
+	case <-fs.ctx.Done():
+		return fs.ctx.Err()
+	}
+	return nil
+}
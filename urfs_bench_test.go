@@ -0,0 +1,146 @@
+package urfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// Helper function that benchmarks walking a small directory with the
+// default number of workers and either a fixed or an adaptive pool.
+func benchmarkWalkPool(b *testing.B, fixed bool) {
+	files := make(map[string]string)
+	for i := 0; i < 12; i++ {
+		files[fmt.Sprintf("file%02d.txt", i)] = "a"
+	}
+
+	root := makeTree(b, files)
+	defer os.RemoveAll(root)
+
+	walkFn := func(path string) (string, error) { return path, nil }
+
+	var workers int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := makeWalker()
+		fs.Workers = DefaultWorkers
+		fs.fixedPool = fixed
+		if err := fs.Walk(root, walkFn); err != nil {
+			b.Fatal(err.Error())
+		}
+		workers += fs.nWorkers
+	}
+
+	b.ReportMetric(float64(workers)/float64(b.N), "workers/op")
+}
+
+func BenchmarkWalkFixedPool(b *testing.B) {
+	benchmarkWalkPool(b, true)
+}
+
+func BenchmarkWalkAdaptivePool(b *testing.B) {
+	benchmarkWalkPool(b, false)
+}
+
+// Helper function that benchmarks walking a directory of many files with the
+// specified size of the path and result channels.
+func benchmarkWalkBuffer(b *testing.B, buffer int) {
+	files := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		files[fmt.Sprintf("dir%02d/file%04d.txt", i%20, i)] = "a"
+	}
+
+	root := makeTree(b, files)
+	defer os.RemoveAll(root)
+
+	walkFn := func(path string) (string, error) { return path, nil }
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := makeWalker()
+		fs.Buffer = buffer
+		fs.Reset(context.Background())
+		if err := fs.Walk(root, walkFn); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+
+	b.ReportMetric(float64(len(files)*b.N)/b.Elapsed().Seconds(), "paths/s")
+}
+
+func BenchmarkWalkBuffer1(b *testing.B) {
+	benchmarkWalkBuffer(b, 1)
+}
+
+func BenchmarkWalkBuffer10(b *testing.B) {
+	benchmarkWalkBuffer(b, 10)
+}
+
+func BenchmarkWalkBuffer100(b *testing.B) {
+	benchmarkWalkBuffer(b, 100)
+}
+
+func BenchmarkWalkBuffer1000(b *testing.B) {
+	benchmarkWalkBuffer(b, 1000)
+}
+
+func BenchmarkWalkBuffer10000(b *testing.B) {
+	benchmarkWalkBuffer(b, 10000)
+}
+
+func BenchmarkWalkFile(b *testing.B) {
+	root := makeTree(b, map[string]string{"file.txt": "a"})
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "file.txt")
+	walkFn := func(path string) (string, error) { return path, nil }
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := makeWalker()
+		if err := fs.Walk(path, walkFn); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+// Helper function that benchmarks walking a wide tree of many small
+// directories, reading the specified number of directories concurrently.
+func benchmarkWalkDirWorkers(b *testing.B, dirWorkers int) {
+	files := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		files[fmt.Sprintf("dir%03d/sub%d/file%04d.txt", i%200, i%5, i)] = "a"
+	}
+
+	root := makeTree(b, files)
+	defer os.RemoveAll(root)
+
+	walkFn := func(path string) (string, error) { return path, nil }
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := makeWalker()
+		fs.DirWorkers = dirWorkers
+		if err := fs.Walk(root, walkFn); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+
+	b.ReportMetric(float64(len(files)*b.N)/b.Elapsed().Seconds(), "paths/s")
+}
+
+// Benchmarks filepath.Walk, which reads one directory at a time.
+func BenchmarkWalkDirWorkers1(b *testing.B) {
+	benchmarkWalkDirWorkers(b, 1)
+}
+
+func BenchmarkWalkDirWorkers4(b *testing.B) {
+	benchmarkWalkDirWorkers(b, 4)
+}
+
+func BenchmarkWalkDirWorkers16(b *testing.B) {
+	benchmarkWalkDirWorkers(b, 16)
+}
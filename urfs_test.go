@@ -1 +1,1203 @@
 package urfs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Helper function that creates a temporary directory containing the
+// specified files (relative path to contents), returning the root path.
+func makeTree(t testing.TB, files map[string]string) string {
+	tmpdir, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for name, data := range files {
+		path := filepath.Join(tmpdir, name)
+		if err := Mkdir(filepath.Dir(path)); err != nil {
+			os.RemoveAll(tmpdir)
+			t.Fatal(err.Error())
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			os.RemoveAll(tmpdir)
+			t.Fatal(err.Error())
+		}
+	}
+
+	return tmpdir
+}
+
+// Helper function that walks the root and returns the sorted base names of
+// all of the paths passed to the walk function.
+func walkNames(fs *FSWalker, root string) ([]string, error) {
+	var mu sync.Mutex
+	names := make([]string, 0)
+
+	err := fs.Walk(root, func(path string) (string, error) {
+		mu.Lock()
+		names = append(names, filepath.Base(path))
+		mu.Unlock()
+		return path, nil
+	})
+
+	sort.Strings(names)
+	return names, err
+}
+
+// Helper function that creates an initialized walker with few workers.
+func makeWalker() *FSWalker {
+	fs := new(FSWalker)
+	fs.Init(context.Background())
+	fs.Workers = 4
+	return fs
+}
+
+func TestContinueOnError(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+		"c.txt": "c",
+		"d.txt": "d",
+	})
+	defer os.RemoveAll(root)
+
+	failing := func(path string) (string, error) {
+		if name := filepath.Base(path); name == "b.txt" || name == "d.txt" {
+			return "", fmt.Errorf("could not process %s", name)
+		}
+		return path, nil
+	}
+
+	// by default the first error aborts the walk
+	fs := makeWalker()
+	if err := fs.Walk(root, failing); err == nil {
+		t.Fatal("expected walk to return an error")
+	} else if _, ok := err.(WalkErrors); ok {
+		t.Fatal("did not expect collected errors when not continuing on error")
+	}
+
+	// if continuing on error, the errors are collected
+	fs = makeWalker()
+	fs.ContinueOnError = true
+	err := fs.Walk(root, failing)
+	if err == nil {
+		t.Fatal("expected walk to return collected errors")
+	}
+
+	errs, ok := err.(WalkErrors)
+	if !ok {
+		t.Fatalf("expected WalkErrors, got %T", err)
+	}
+
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors collected, got %d", len(errs))
+	}
+
+	if fs.nResults != 2 {
+		t.Errorf("expected 2 results, got %d", fs.nResults)
+	}
+}
+
+func TestWalkAccessors(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/c.txt": "c",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	err := fs.Walk(root, func(path string) (string, error) {
+		if filepath.Base(path) == "a.txt" {
+			return "", nil
+		}
+		return path, nil
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.NumPaths() != 3 {
+		t.Errorf("expected 3 paths, got %d", fs.NumPaths())
+	}
+
+	if fs.NumResults() != 2 {
+		t.Errorf("expected 2 results, got %d", fs.NumResults())
+	}
+
+	if fs.Duration() <= 0 {
+		t.Errorf("expected a positive duration, got %s", fs.Duration())
+	}
+}
+
+func TestOnProgress(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < ProgressInterval*2+10; i++ {
+		files[fmt.Sprintf("file%04d.txt", i)] = "a"
+	}
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	var calls int
+	var last uint64
+
+	fs := makeWalker()
+	fs.OnProgress = func(paths, results uint64) {
+		calls++
+		if results < last {
+			t.Errorf("progress went backwards from %d to %d", last, results)
+		}
+		if results > paths {
+			t.Errorf("more results (%d) than paths (%d)", results, paths)
+		}
+		last = results
+	}
+
+	if err := fs.Walk(root, func(path string) (string, error) { return path, nil }); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 progress calls, got %d", calls)
+	}
+
+	if last != uint64(len(files)) {
+		t.Errorf("expected final progress of %d results, got %d", len(files), last)
+	}
+}
+
+func TestOnFile(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "bb",
+		"sub/c.txt": "ccc",
+		"sub/d.txt": "dddd",
+	})
+	defer os.RemoveAll(root)
+
+	var mu sync.Mutex
+	sizes := make(map[string]int64)
+
+	fs := makeWalker()
+	fs.OnFile = func(path string, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes[filepath.Base(path)] = size
+	}
+
+	// files the walk function fails on are not reported
+	fs.ContinueOnError = true
+	fs.Walk(root, func(path string) (string, error) {
+		if filepath.Base(path) == "d.txt" {
+			return "", fmt.Errorf("could not process %s", path)
+		}
+		return path, nil
+	})
+
+	expected := map[string]int64{"a.txt": 1, "b.txt": 2, "c.txt": 3}
+	if len(sizes) != len(expected) {
+		t.Errorf("expected %d files reported, got %v", len(expected), sizes)
+	}
+
+	for name, size := range expected {
+		if sizes[name] != size {
+			t.Errorf("expected %s to be reported with %d bytes, got %d", name, size, sizes[name])
+		}
+	}
+}
+
+func TestWalkSorted(t *testing.T) {
+	files := make(map[string]string)
+	expected := make([]string, 0, 60)
+	for i := 0; i < 60; i++ {
+		rel := filepath.Join(fmt.Sprintf("dir%d", i%4), fmt.Sprintf("file%02d.txt", i))
+		files[rel] = "a"
+		expected = append(expected, rel)
+	}
+	sort.Strings(expected)
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	// sleep for a varying amount of time to shuffle the order workers finish
+	jitter := func(path string) (string, error) {
+		time.Sleep(time.Duration(len(path)%7) * time.Millisecond)
+		rel, err := filepath.Rel(root, path)
+		return rel, err
+	}
+
+	for i := 0; i < 3; i++ {
+		fs := makeWalker()
+		fs.Workers = 8
+		fs.Sorted = true
+
+		out := make(chan string, 10)
+		results := make([]string, 0, len(expected))
+		done := make(chan struct{})
+		go func() {
+			for r := range out {
+				results = append(results, r)
+			}
+			close(done)
+		}()
+
+		err := fs.WalkStream(root, jitter, out)
+		close(out)
+		<-done
+
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(results, ",") != strings.Join(expected, ",") {
+			t.Fatalf("run %d: expected sorted results %v, got %v", i, expected, results)
+		}
+	}
+
+	// paths discovered under nested roots are only processed once
+	fs := makeWalker()
+	fs.Sorted = true
+	if err := fs.WalkMulti([]string{root, filepath.Join(root, "dir0")}, jitter); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.NumResults() != 60 {
+		t.Errorf("expected 60 results with nested roots, got %d", fs.NumResults())
+	}
+}
+
+func TestWalkCollect(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b/c.txt":   "hello world",
+		"b/d/e.txt": "",
+	})
+	defer os.RemoveAll(root)
+
+	type entry struct {
+		name string
+		size int64
+	}
+
+	fs := makeWalker()
+	entries, err := WalkCollect(fs, root, func(path string) (entry, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return entry{}, err
+		}
+		return entry{info.Name(), info.Size()}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	expected := []entry{{"a.txt", 5}, {"c.txt", 11}, {"e.txt", 0}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, got %v", expected, entries)
+	}
+
+	if fs.NumResults() != 3 {
+		t.Errorf("expected 3 results, got %d", fs.NumResults())
+	}
+
+	// errors returned by the function abort the walk
+	fs = makeWalker()
+	_, err = WalkCollect(fs, root, func(path string) (int, error) {
+		return 0, errors.New("bad file")
+	})
+
+	if err == nil || err.Error() != "bad file" {
+		t.Errorf("expected error from the function, got %v", err)
+	}
+}
+
+func TestWalkStream(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/c.txt": "c",
+	})
+	defer os.RemoveAll(root)
+
+	out := make(chan string)
+	results := make([]string, 0)
+	done := make(chan struct{})
+
+	go func() {
+		for result := range out {
+			results = append(results, result)
+		}
+		close(done)
+	}()
+
+	fs := makeWalker()
+	err := fs.WalkStream(root, func(path string) (string, error) {
+		if filepath.Base(path) == "b.txt" {
+			return "", nil
+		}
+		return filepath.Base(path), nil
+	}, out)
+
+	close(out)
+	<-done
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sort.Strings(results)
+	if len(results) != 2 || results[0] != "a.txt" || results[1] != "c.txt" {
+		t.Errorf("unexpected streamed results: %v", results)
+	}
+}
+
+func TestSizeFilter(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"empty.txt":  "",
+		"small.txt":  strings.Repeat("a", 10),
+		"medium.txt": strings.Repeat("b", 100),
+		"large.txt":  strings.Repeat("c", 1000),
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		min, max int64
+		expected []string
+	}{
+		{0, 0, []string{"empty.txt", "large.txt", "medium.txt", "small.txt"}},
+		{10, 0, []string{"large.txt", "medium.txt", "small.txt"}},
+		{11, 0, []string{"large.txt", "medium.txt"}},
+		{0, 100, []string{"empty.txt", "medium.txt", "small.txt"}},
+		{10, 100, []string{"medium.txt", "small.txt"}},
+		{101, 999, []string{}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.MinSize = tt.min
+		fs.MaxSize = tt.max
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("size range [%d, %d]: expected %v, got %v", tt.min, tt.max, tt.expected, names)
+		}
+	}
+}
+
+func TestModTimeFilter(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"jan.txt": "a",
+		"feb.txt": "b",
+		"mar.txt": "c",
+	})
+	defer os.RemoveAll(root)
+
+	jan := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, mtime := range map[string]time.Time{"jan.txt": jan, "feb.txt": feb, "mar.txt": mar} {
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	tests := []struct {
+		after, before time.Time
+		expected      []string
+	}{
+		{time.Time{}, time.Time{}, []string{"feb.txt", "jan.txt", "mar.txt"}},
+		{feb, time.Time{}, []string{"feb.txt", "mar.txt"}},
+		{time.Time{}, feb, []string{"jan.txt"}},
+		{jan, mar, []string{"feb.txt", "jan.txt"}},
+		{feb, feb, []string{}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.ModifiedAfter = tt.after
+		fs.ModifiedBefore = tt.before
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("time range [%s, %s): expected %v, got %v", tt.after, tt.before, tt.expected, names)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":             "a",
+		"logs/b.txt":        "b",
+		"logs/c.log":        "c",
+		"logs/nested/d.txt": "d",
+		"other/e.txt":       "e",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		match     string
+		matchPath bool
+		expected  []string
+	}{
+		{"*.txt", false, []string{"a.txt", "b.txt", "d.txt", "e.txt"}},
+		{"logs/*.txt", false, []string{}},
+		{"*.txt", true, []string{"a.txt"}},
+		{"logs/*.txt", true, []string{"b.txt"}},
+		{"logs/*/*.txt", true, []string{"d.txt"}},
+		{"*/*", true, []string{"b.txt", "c.log", "e.txt"}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.Match = filepath.FromSlash(tt.match)
+		fs.MatchPath = tt.matchPath
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("match %q (path %t): expected %v, got %v", tt.match, tt.matchPath, tt.expected, names)
+		}
+	}
+}
+
+func TestIgnoreCase(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"Photo.JPG":  "a",
+		"photo.jpg":  "b",
+		"ÉCLAIR.JPG": "c",
+		"notes.txt":  "d",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		match      string
+		exclude    string
+		ignoreCase bool
+		expected   []string
+	}{
+		{"*.jpg", "", false, []string{"photo.jpg"}},
+		{"*.jpg", "", true, []string{"Photo.JPG", "photo.jpg", "ÉCLAIR.JPG"}},
+		{"*.JPG", "", true, []string{"Photo.JPG", "photo.jpg", "ÉCLAIR.JPG"}},
+		{"éclair.*", "", false, []string{}},
+		{"éclair.*", "", true, []string{"ÉCLAIR.JPG"}},
+		{"*.jpg", "PHOTO.*", true, []string{"ÉCLAIR.JPG"}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.Match = tt.match
+		fs.Exclude = tt.exclude
+		fs.IgnoreCase = tt.ignoreCase
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("match %q exclude %q (ignore case %t): expected %v, got %v", tt.match, tt.exclude, tt.ignoreCase, tt.expected, names)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"b.tmp":     "b",
+		"c.bak":     "c",
+		"sub/d.txt": "d",
+		"sub/e.tmp": "e",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		match, exclude string
+		expected       []string
+	}{
+		{"*", "", []string{"a.txt", "b.tmp", "c.bak", "d.txt", "e.tmp"}},
+		{"*", "*.tmp", []string{"a.txt", "c.bak", "d.txt"}},
+		{"*", "*.tmp, *.bak", []string{"a.txt", "d.txt"}},
+		{"*.txt", "d.*", []string{"a.txt"}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.Match = tt.match
+		fs.Exclude = tt.exclude
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("match %q exclude %q: expected %v, got %v", tt.match, tt.exclude, tt.expected, names)
+		}
+	}
+}
+
+func TestWalkTimeout(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("file%03d.txt", i)] = "a"
+	}
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	slow := func(path string) (string, error) {
+		time.Sleep(10 * time.Millisecond)
+		return path, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	fs := new(FSWalker)
+	fs.Init(ctx)
+	fs.Workers = 1
+	defer fs.Close()
+
+	if err := fs.Walk(root, slow); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if fs.NumResults() >= 100 {
+		t.Errorf("expected the walk to be canceled before processing all paths")
+	}
+
+	// the deadline should be preserved when the walker is reset
+	fs.Reset(nil)
+	if err := fs.Walk(root, slow); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded after reset, got %v", err)
+	}
+}
+
+func TestWalkCancel(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("file%03d.txt", i)] = "a"
+	}
+
+	root := makeTree(t, files)
+	defer os.RemoveAll(root)
+
+	slow := func(path string) (string, error) {
+		time.Sleep(10 * time.Millisecond)
+		return path, nil
+	}
+
+	fs := makeWalker()
+	fs.Workers = 1
+	defer fs.Close()
+
+	timer := time.AfterFunc(50*time.Millisecond, fs.Cancel)
+	defer timer.Stop()
+
+	start := time.Now()
+	if err := fs.Walk(root, slow); err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the walk to return promptly after cancel, took %s", elapsed)
+	}
+
+	if fs.NumResults() >= 100 {
+		t.Errorf("expected the walk to be canceled before processing all paths")
+	}
+
+	// the walker can walk again after it has been canceled
+	if err := fs.Walk(root, func(path string) (string, error) { return path, nil }); err != nil {
+		t.Fatalf("expected walk after cancel to succeed, got %v", err)
+	}
+
+	if fs.NumResults() != 100 {
+		t.Errorf("expected 100 results after cancel, got %d", fs.NumResults())
+	}
+}
+
+func TestWalkTwice(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/c.txt": "c",
+	})
+	defer os.RemoveAll(root)
+
+	other := makeTree(t, map[string]string{
+		"d.txt": "d",
+		"e.txt": "e",
+	})
+	defer os.RemoveAll(other)
+
+	walkFn := func(path string) (string, error) { return path, nil }
+
+	fs := makeWalker()
+	if err := fs.Walk(root, walkFn); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.NumPaths() != 3 || fs.NumResults() != 3 {
+		t.Fatalf("first walk: expected 3 paths and results, got %d and %d", fs.NumPaths(), fs.NumResults())
+	}
+
+	if err := fs.Walk(other, walkFn); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fs.NumPaths() != 2 || fs.NumResults() != 2 {
+		t.Fatalf("second walk: expected 2 paths and results, got %d and %d", fs.NumPaths(), fs.NumResults())
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":       "a",
+		"b/b.txt":     "b",
+		"b/c/c.txt":   "c",
+		"b/c/d/d.txt": "d",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		depth    int
+		expected []string
+	}{
+		{0, []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		{1, []string{"a.txt"}},
+		{2, []string{"a.txt", "b.txt"}},
+		{3, []string{"a.txt", "b.txt", "c.txt"}},
+		{10, []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.MaxDepth = tt.depth
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("depth %d: expected %v, got %v", tt.depth, tt.expected, names)
+		}
+	}
+
+	// ensure that directories at the maximum depth are pruned
+	fs := makeWalker()
+	fs.MaxDepth = 2
+
+	for dir, expected := range map[string]error{"b": nil, "b/c": filepath.SkipDir} {
+		path := filepath.Join(root, filepath.FromSlash(dir))
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := fs.filterPaths(root, path, info, nil); err != expected {
+			t.Errorf("expected %v filtering directory %s, got %v", expected, dir, err)
+		}
+	}
+}
+
+func TestIncludeHidden(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":          "a",
+		".gitignore":     "b",
+		".DS_Store":      "c",
+		"sub/.gitignore": "d",
+		"sub/~backup":    "e",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		include  []string
+		expected []string
+	}{
+		{nil, []string{"a.txt"}},
+		{[]string{".gitignore"}, []string{".gitignore", ".gitignore", "a.txt"}},
+		{[]string{".git*", "~*"}, []string{".gitignore", ".gitignore", "a.txt", "~backup"}},
+	}
+
+	for _, tt := range tests {
+		fs := makeWalker()
+		fs.IncludeHidden = tt.include
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("include %v: expected %v, got %v", tt.include, tt.expected, names)
+		}
+	}
+}
+
+func TestSkipPermissionErrors(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":        "a",
+		"denied/b.txt": "b",
+		"sub/c.txt":    "c",
+	})
+	defer os.RemoveAll(root)
+
+	// Simulate the error returned by the walk for an unreadable directory,
+	// which cannot be created reliably when running as root or on windows.
+	denied := filepath.Join(root, "denied")
+	info, err := os.Stat(denied)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	perr := &os.PathError{Op: "open", Path: denied, Err: os.ErrPermission}
+
+	fs := makeWalker()
+	if err := fs.filterPaths(root, denied, info, perr); err != perr {
+		t.Errorf("expected permission error to be returned, got %v", err)
+	}
+
+	fs.SkipPermissionErrors = true
+	if err := fs.filterPaths(root, denied, info, perr); err != filepath.SkipDir {
+		t.Errorf("expected denied directory to be skipped, got %v", err)
+	}
+
+	if denied := fs.Denied(); len(denied) != 1 || denied[0] != perr {
+		t.Errorf("expected permission error to be collected, got %v", denied)
+	}
+
+	// Walk a directory that is actually unreadable where possible
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+
+	if err := os.Chmod(denied, 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Chmod(denied, 0755)
+
+	fs = makeWalker()
+	fs.SkipPermissionErrors = true
+	names, err := walkNames(fs, root)
+	if err != nil {
+		t.Fatalf("expected walk to complete, got %s", err)
+	}
+
+	if len(names) != 2 || names[0] != "a.txt" || names[1] != "c.txt" {
+		t.Errorf("unexpected files walked: %v", names)
+	}
+
+	if len(fs.Denied()) != 1 {
+		t.Errorf("expected 1 denied path, got %v", fs.Denied())
+	}
+}
+
+func TestDirFunc(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":            "a",
+		"sub/b.txt":        "b",
+		"sub/deep/c.txt":   "c",
+		"other/d.txt":      "d",
+		".hidden/e.txt":    "e",
+		"sub/.cache/f.txt": "f",
+	})
+	defer os.RemoveAll(root)
+
+	var mu sync.Mutex
+	dirs := make([]string, 0)
+
+	fs := makeWalker()
+	fs.DirFunc = func(path string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dirs = append(dirs, filepath.Base(path))
+		return path, nil
+	}
+
+	names, err := walkNames(fs, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the directories may be processed in any order
+	sort.Strings(dirs)
+	expected := []string{filepath.Base(root), "deep", "other", "sub"}
+	sort.Strings(expected)
+
+	if strings.Join(dirs, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected directories %v, got %v", expected, dirs)
+	}
+
+	// directory results are not counted as results of the walk
+	if fs.NumResults() != uint64(len(names)) {
+		t.Errorf("expected %d file results, got %d", len(names), fs.NumResults())
+	}
+
+	// errors from the directory function abort the walk
+	fs.DirFunc = func(path string) (string, error) {
+		return "", fmt.Errorf("could not process %s", path)
+	}
+
+	if _, err := walkNames(fs, root); err == nil {
+		t.Error("expected directory function error to be returned")
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.mp4":     "a",
+		"b.MP4":     "b",
+		"c.mkv":     "c",
+		"d.txt":     "d",
+		"sub/e.Mkv": "e",
+		"mp4":       "f",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		extensions []string
+		expected   []string
+	}{
+		{nil, []string{"a.mp4", "b.MP4", "c.mkv", "d.txt", "e.Mkv", "mp4"}},
+		{[]string{"mp4"}, []string{"a.mp4", "b.MP4"}},
+		{[]string{"mp4", ".MKV"}, []string{"a.mp4", "b.MP4", "c.mkv", "e.Mkv"}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		fs.Extensions = tc.extensions
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		sort.Strings(tc.expected)
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("extensions %v: expected %v, got %v", tc.extensions, tc.expected, names)
+		}
+	}
+}
+
+func TestExcludeExtensions(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":       "aa",
+		"b.log":       "bbb",
+		"c.LOG":       "ccc",
+		"d.tmp":       "ddd",
+		"sub/e.txt":   "ee",
+		"sub/f.Tmp":   "fff",
+		"sub/g.jpg":   "gg",
+		"sub/tmp":     "hhh",
+		"sub/log.txt": "ii",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	fs.ExcludeExtensions = []string{"tmp", ".log"}
+
+	names, err := walkNames(fs, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []string{"a.txt", "e.txt", "g.jpg", "log.txt", "tmp"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	// The excluded files are not counted, but all of the others are
+	sizes, err := fs.Count(false, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if sizes[0].Files != 5 || sizes[0].Bytes != 11 {
+		t.Errorf("expected 5 files and 11 bytes to be counted, got %d files and %d bytes", sizes[0].Files, sizes[0].Bytes)
+	}
+
+	// Excluded extensions take precedence over the extensions to include
+	fs.Extensions = []string{"txt", "log"}
+	if names, err = walkNames(fs, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected = []string{"a.txt", "e.txt", "log.txt"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestInvert(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.jpg":       "a",
+		"b.JPG":       "b",
+		"c.png":       "c",
+		"d.txt":       "d",
+		"sub/e.gif":   "e",
+		"sub/f.jpg":   "f",
+		".hidden.png": "g",
+		".git/h.txt":  "h",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		match      string
+		extensions []string
+		expected   []string
+	}{
+		{"*", []string{"jpg"}, []string{"c.png", "d.txt", "e.gif"}},
+		{"*.txt", nil, []string{"a.jpg", "b.JPG", "c.png", "e.gif", "f.jpg"}},
+		{"*.png", []string{"png"}, []string{"a.jpg", "b.JPG", "d.txt", "e.gif", "f.jpg"}},
+		{"*", nil, []string{}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		fs.Match = tc.match
+		fs.Extensions = tc.extensions
+		fs.Invert = true
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("match %q extensions %v: expected %v, got %v", tc.match, tc.extensions, tc.expected, names)
+		}
+	}
+}
+
+func TestHiddenPrefixes(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":        "a",
+		".b.txt":       "b",
+		"~c.txt":       "c",
+		"#d.txt#":      "d",
+		"#autosave/e":  "e",
+		"sub/.f.txt":   "f",
+		"sub/#g.txt#":  "g",
+		"sub/h.txt":    "h",
+		".git/i.txt":   "i",
+		"~backup/j.md": "j",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		prefixes []string
+		expected []string
+	}{
+		{nil, []string{"#d.txt#", "#g.txt#", "a.txt", "e", "h.txt"}},
+		{[]string{}, []string{"#d.txt#", "#g.txt#", "a.txt", "e", "h.txt"}},
+		{[]string{".", "~", "#"}, []string{"a.txt", "h.txt"}},
+		{[]string{"#"}, []string{".b.txt", ".f.txt", "a.txt", "h.txt", "i.txt", "j.md", "~c.txt"}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		fs.HiddenPrefixes = tc.prefixes
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("prefixes %v: expected %v, got %v", tc.prefixes, tc.expected, names)
+		}
+	}
+}
+
+func TestSkipDirNames(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.js":                         "a",
+		"node_modules/b.js":            "b",
+		"src/c.go":                     "c",
+		"src/vendor/pkg/d.go":          "d",
+		"src/node_modules/pkg/e.js":    "e",
+		"src/node_modules_backup/f.js": "f",
+		"vendor.go":                    "g",
+	})
+	defer os.RemoveAll(root)
+
+	var mu sync.Mutex
+	processed := make([]string, 0)
+
+	fs := makeWalker()
+	fs.SkipDirNames = []string{"node_modules", "vendor"}
+	err := fs.Walk(root, func(path string) (string, error) {
+		mu.Lock()
+		processed = append(processed, filepath.Base(path))
+		mu.Unlock()
+		return path, nil
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	sort.Strings(processed)
+	if strings.Join(processed, ",") != "a.js,c.go,f.js,vendor.go" {
+		t.Errorf("expected files in skipped directories not to be processed, got %v", processed)
+	}
+
+	// the root of the walk is not skipped even if it has a skipped name
+	fs = makeWalker()
+	fs.SkipDirNames = []string{"node_modules"}
+	names, err := walkNames(fs, filepath.Join(root, "node_modules"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Join(names, ",") != "b.js" {
+		t.Errorf("expected the root to be walked, got %v", names)
+	}
+}
+
+func TestSkipHiddenDirs(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":                 "a",
+		".git/objects/b.txt":    "b",
+		"sub/.cache/c.txt":      "c",
+		"sub/d.txt":             "d",
+		"~backup/e.txt":         "e",
+		".config/settings.conf": "f",
+	})
+	defer os.RemoveAll(root)
+
+	fs := makeWalker()
+	names, err := walkNames(fs, root)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Join(names, ",") != "a.txt,d.txt" {
+		t.Errorf("expected files in hidden directories to be skipped, got %v", names)
+	}
+
+	// hidden directories can be included by pattern
+	fs.IncludeHidden = []string{".config"}
+	if names, err = walkNames(fs, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Join(names, ",") != "a.txt,d.txt,settings.conf" {
+		t.Errorf("expected included hidden directory to be walked, got %v", names)
+	}
+
+	// all files are walked if hidden files are not skipped
+	fs.SkipHidden = false
+	if names, err = walkNames(fs, root); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(names) != 6 {
+		t.Errorf("expected all 6 files to be walked, got %v", names)
+	}
+}
+
+func TestMimeTypes(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"image.dat": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"photo.jpg": "\xff\xd8\xff\xe0\x00\x10JFIF\x00",
+		"notes.png": "these are not really an image",
+		"page.html": "<html><body>hello</body></html>",
+	})
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		mimeTypes []string
+		expected  []string
+	}{
+		{nil, []string{"image.dat", "notes.png", "page.html", "photo.jpg"}},
+		{[]string{"image/png"}, []string{"image.dat"}},
+		{[]string{"image/jpeg", "IMAGE/PNG"}, []string{"image.dat", "photo.jpg"}},
+		{[]string{"text/plain"}, []string{"notes.png"}},
+	}
+
+	for _, tc := range tests {
+		fs := makeWalker()
+		fs.MimeTypes = tc.mimeTypes
+
+		names, err := walkNames(fs, root)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("mime types %v: expected %v, got %v", tc.mimeTypes, tc.expected, names)
+		}
+	}
+}
+
+func TestFileTimeout(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":    "a",
+		"b.txt":    "b",
+		"slow.txt": "slow",
+	})
+	defer os.RemoveAll(root)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	fs := makeWalker()
+	fs.FileTimeout = 50 * time.Millisecond
+
+	// the slow file blocks until the test completes
+	started := time.Now()
+	err := fs.Walk(root, func(path string) (string, error) {
+		if filepath.Base(path) == "slow.txt" {
+			<-release
+		}
+		return path, nil
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("expected walk to abandon the slow file, took %s", elapsed)
+	}
+
+	timedOut := fs.TimedOut()
+	if len(timedOut) != 1 || filepath.Base(timedOut[0]) != "slow.txt" {
+		t.Errorf("expected slow.txt to time out, got %v", timedOut)
+	}
+
+	if fs.NumResults() != 2 {
+		t.Errorf("expected 2 results, got %d", fs.NumResults())
+	}
+}
@@ -0,0 +1,113 @@
+package urfs
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Verify that the files in the destination directory (dst), e.g. a sample,
+// are identical to the files at the same relative path in the source
+// directory (src). Returns the relative paths of files that do not match
+// followed by those that are missing from the source. Use VerifyFiles to
+// get the mismatched and missing files separately.
+func (fs *FSWalker) Verify(src, dst string) ([]string, error) {
+	result, err := fs.VerifyFiles(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make([]string, 0, len(result.Mismatched)+len(result.Missing))
+	failed = append(failed, result.Mismatched...)
+	failed = append(failed, result.Missing...)
+	return failed, nil
+}
+
+// VerifyFiles walks the destination directory (dst), mapping each file back
+// to the source directory (src) by its relative path and comparing the files
+// first by size then by the SHA-256 digest of their contents, which is
+// computed by streaming the files so that they are not loaded into memory.
+func (fs *FSWalker) VerifyFiles(src, dst string) (*VerifyResult, error) {
+	var mu sync.Mutex
+	result := &VerifyResult{
+		Mismatched: make([]string, 0),
+		Missing:    make([]string, 0),
+	}
+
+	err := fs.Walk(dst, func(path string) (string, error) {
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return "", err
+		}
+
+		same, err := sameContents(filepath.Join(src, rel), path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+
+			mu.Lock()
+			result.Missing = append(result.Missing, rel)
+			mu.Unlock()
+			return path, nil
+		}
+
+		if !same {
+			mu.Lock()
+			result.Mismatched = append(result.Mismatched, rel)
+			mu.Unlock()
+			return path, nil
+		}
+
+		atomic.AddUint64(&result.Verified, 1)
+		return "", nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.Mismatched)
+	sort.Strings(result.Missing)
+	return result, nil
+}
+
+// VerifyResult describes the comparison of a destination to its source.
+type VerifyResult struct {
+	Verified   uint64   // number of files that are identical to the source
+	Mismatched []string // relative paths of files that differ from the source
+	Missing    []string // relative paths of files that are not in the source
+}
+
+// Internal helper function that compares the files at the two paths, first
+// by size and then by content digest.
+func sameContents(a, b string) (bool, error) {
+	ainfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+
+	binfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+
+	if ainfo.Size() != binfo.Size() {
+		return false, nil
+	}
+
+	adigest, err := hashFile(a, sha256.New())
+	if err != nil {
+		return false, err
+	}
+
+	bdigest, err := hashFile(b, sha256.New())
+	if err != nil {
+		return false, err
+	}
+
+	return adigest == bdigest, nil
+}
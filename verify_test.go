@@ -0,0 +1,71 @@
+package urfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	src := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b.txt":     "world",
+		"sub/c.txt": "foo",
+		"sub/d.txt": "bar",
+	})
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "com.bengfort.urfs-")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dst)
+
+	fs := makeWalker()
+	if _, err := fs.Sample(src, dst, 1.0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// an exact copy should verify
+	fs = makeWalker()
+	failed, err := fs.Verify(src, dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(failed) != 0 {
+		t.Fatalf("expected copy to verify, got %v", failed)
+	}
+
+	// modify files in the destination: same size, different size, and extra
+	if err := ioutil.WriteFile(filepath.Join(dst, "a.txt"), []byte("jello"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dst, "sub", "c.txt"), []byte("foobar"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dst, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs = makeWalker()
+	result, err := fs.VerifyFiles(src, dst)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result.Verified != 2 {
+		t.Errorf("expected 2 verified files, got %d", result.Verified)
+	}
+
+	if len(result.Mismatched) != 2 || result.Mismatched[0] != "a.txt" || result.Mismatched[1] != filepath.Join("sub", "c.txt") {
+		t.Errorf("unexpected mismatched files: %v", result.Mismatched)
+	}
+
+	if len(result.Missing) != 1 || result.Missing[0] != "extra.txt" {
+		t.Errorf("unexpected missing files: %v", result.Missing)
+	}
+}
@@ -0,0 +1,92 @@
+package urfs
+
+import (
+	"encoding/json"
+	"hash"
+	"sync"
+	"time"
+)
+
+// CombineWalkFuncs returns a WalkFunc that applies each of the specified
+// functions in order to every path, so that multiple operations can be
+// performed in a single walk. If any function returns an error, the
+// remaining functions are not called and the error is returned. The result
+// of the combined function is the last non-empty result returned.
+func CombineWalkFuncs(fns ...WalkFunc) WalkFunc {
+	return func(path string) (string, error) {
+		var result string
+		for _, fn := range fns {
+			r, err := fn(path)
+			if err != nil {
+				return "", err
+			}
+
+			if r != "" {
+				result = r
+			}
+		}
+		return result, nil
+	}
+}
+
+// HashWalkFunc returns a WalkFunc that computes the hex digest of the
+// contents of each file using a hash created by h, e.g. sha256.New, storing
+// the digest by path in out. The mutex synchronizes access to the map since
+// the function is called concurrently by the walker's workers.
+func HashWalkFunc(h func() hash.Hash, out map[string]string, mu *sync.Mutex) WalkFunc {
+	return HashHeadWalkFunc(h, 0, out, mu)
+}
+
+// HashHeadWalkFunc returns a WalkFunc like HashWalkFunc that only hashes at
+// most the first n bytes of each file, or all of the contents if n is not
+// positive. Files that share a head have the same digest even if they differ
+// after it, so the digests are only approximate identifiers of the contents.
+func HashHeadWalkFunc(h func() hash.Hash, n int64, out map[string]string, mu *sync.Mutex) WalkFunc {
+	return func(path string) (string, error) {
+		digest, err := hashFileHead(path, h(), n)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		out[path] = digest
+		mu.Unlock()
+		return path, nil
+	}
+}
+
+// FileEntry describes a file processed by a walk, e.g. for JSON output.
+type FileEntry struct {
+	Path    string    `json:"path"`    // path to the file
+	Size    int64     `json:"size"`    // size of the file in bytes
+	ModTime time.Time `json:"modtime"` // modification time of the file
+}
+
+// Entry returns the FileEntry of the file at path on the walker's file
+// system, e.g. to collect the entries of a walk with WalkCollect.
+func (fs *FSWalker) Entry(path string) (*FileEntry, error) {
+	info, err := fs.stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileEntry{Path: path, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// EntryWalkFunc returns a WalkFunc whose result is the FileEntry of each
+// file encoded as a JSON object, so that the entries of huge directories can
+// be streamed with WalkStream as they are discovered rather than after the
+// walk.
+func (fs *FSWalker) EntryWalkFunc() WalkFunc {
+	return func(path string) (string, error) {
+		entry, err := fs.Entry(path)
+		if err != nil {
+			return "", err
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,158 @@
+package urfs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCombineWalkFuncs(t *testing.T) {
+	calls := make([]string, 0)
+	record := func(name, result string) WalkFunc {
+		return func(path string) (string, error) {
+			calls = append(calls, name)
+			return result, nil
+		}
+	}
+
+	combined := CombineWalkFuncs(record("a", "first"), record("b", "second"), record("c", ""))
+	result, err := combined("path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(calls) != 3 || calls[0] != "a" || calls[1] != "b" || calls[2] != "c" {
+		t.Errorf("expected all functions called in order, got %v", calls)
+	}
+
+	if result != "second" {
+		t.Errorf("expected last non-empty result, got %q", result)
+	}
+
+	// errors should short-circuit the remaining functions
+	calls = calls[:0]
+	failed := errors.New("failed")
+	combined = CombineWalkFuncs(record("a", "first"), func(path string) (string, error) {
+		return "", failed
+	}, record("c", "third"))
+
+	if _, err := combined("path"); err != failed {
+		t.Errorf("expected error to be returned, got %v", err)
+	}
+
+	if len(calls) != 1 || calls[0] != "a" {
+		t.Errorf("expected only the first function to be called, got %v", calls)
+	}
+
+	// no functions should do nothing
+	if result, err := CombineWalkFuncs()("path"); result != "" || err != nil {
+		t.Errorf("expected empty result and no error, got %q and %v", result, err)
+	}
+}
+
+func TestHashWalkFunc(t *testing.T) {
+	contents := map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "bravo",
+	}
+
+	root := makeTree(t, contents)
+	defer os.RemoveAll(root)
+
+	algorithms := []struct {
+		name string
+		h    func() hash.Hash
+	}{
+		{"md5", md5.New},
+		{"sha256", sha256.New},
+	}
+
+	for _, alg := range algorithms {
+		var mu sync.Mutex
+		digests := make(map[string]string)
+
+		fs := makeWalker()
+		if err := fs.Walk(root, HashWalkFunc(alg.h, digests, &mu)); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(digests) != len(contents) {
+			t.Fatalf("%s: expected %d digests, got %d", alg.name, len(contents), len(digests))
+		}
+
+		for rel, data := range contents {
+			h := alg.h()
+			h.Write([]byte(data))
+			expected := hex.EncodeToString(h.Sum(nil))
+
+			path := filepath.Join(root, rel)
+			if digests[path] != expected {
+				t.Errorf("%s: expected digest %q for %s, got %q", alg.name, expected, rel, digests[path])
+			}
+		}
+	}
+}
+
+func TestEntryWalkFunc(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "hello",
+		"b/c.txt":   "hello world",
+		"b/d/e.txt": "",
+	})
+	defer os.RemoveAll(root)
+
+	out := make(chan string)
+	entries := make(map[string]*FileEntry)
+	done := make(chan error)
+	go func() {
+		var derr error
+		for line := range out {
+			entry := new(FileEntry)
+			if err := json.Unmarshal([]byte(line), entry); err != nil && derr == nil {
+				derr = err
+			}
+			entries[entry.Path] = entry
+		}
+		done <- derr
+	}()
+
+	fs := makeWalker()
+	err := fs.WalkStream(root, fs.EntryWalkFunc(), out)
+	close(out)
+	if derr := <-done; derr != nil {
+		t.Fatal(derr.Error())
+	}
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := map[string]int64{"a.txt": 5, "b/c.txt": 11, "b/d/e.txt": 0}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+
+	for rel, size := range expected {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		entry, ok := entries[path]
+		if !ok {
+			t.Errorf("missing entry for %s", rel)
+			continue
+		}
+
+		if entry.Size != size {
+			t.Errorf("expected %s to be %d bytes, got %d", rel, size, entry.Size)
+		}
+
+		if entry.ModTime.IsZero() {
+			t.Errorf("expected modtime for %s", rel)
+		}
+	}
+}